@@ -0,0 +1,313 @@
+package csv
+
+import (
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// csv struct tag
+//
+//	Name string `csv:"name,required,nonempty"`
+//	Num  int    `csv:",default=100"`
+//	Memo string `csv:"-"`
+//
+// 第一项是列名,为空时使用字段名,有列名时只能用这个列名,不再使用字段名和protobuf,json的字段别名
+// "-"表示这个字段不对应任何列,读取时不赋值,写入时不写入
+// 后面是选项
+//   - required: 表头中必须有这一列
+//   - nonempty: 单元格不能为空
+//   - default=xxx: 单元格为空时使用的默认值,和单元格一样解析,不能包含逗号
+//   - comment=xxx: key-value格式的csv中的注释,写入csv时使用,不能包含逗号
+//   - ignore: 读取时忽略这一列(不输出未知列的警告),写入时不写入
+//   - omitempty: 写入时这一列都为空时不写入这一列,key-value格式的csv中值为空时不写入这一行
+//   - strict: 这个字段按严格模式解析,和CsvOption.Strict一样
+//   - key: map表的key列,多个字段时是组合key,如(SkillId,Level)
+type csvTag struct {
+	// 列名
+	Name string
+	// csv:"-",不对应任何列
+	Skip bool
+	// 表头中必须有这一列
+	Required bool
+	// 单元格不能为空
+	NonEmpty bool
+	// 单元格为空时使用的默认值
+	Default    string
+	HasDefault bool
+	// key-value格式的csv中的注释
+	Comment string
+	// 读取时忽略这一列,写入时不写入
+	Ignore bool
+	// 写入时这一列都为空时不写入
+	OmitEmpty bool
+	// 按严格模式解析
+	Strict bool
+	// map表的key列
+	Key bool
+	// 字段的分隔符,如 `csv:",sep=|,kv=:,pair=,"`
+	Separators Separators
+}
+
+func parseCsvTag(tag reflect.StructTag) csvTag {
+	var t csvTag
+	tagString, ok := tag.Lookup("csv")
+	if !ok {
+		return t
+	}
+	if tagString == "-" {
+		// 和json一样,列名是-时使用csv:"-,"
+		t.Skip = true
+		return t
+	}
+	name, options := splitTagOptions(tagString)
+	t.Name = name
+	for _, option := range options {
+		switch option.key {
+		case "required":
+			t.Required = true
+		case "nonempty":
+			t.NonEmpty = true
+		case "default":
+			t.Default = option.value
+			t.HasDefault = true
+		case "comment":
+			t.Comment = option.value
+		case "ignore":
+			t.Ignore = true
+		case "omitempty":
+			t.OmitEmpty = true
+		case "strict":
+			t.Strict = true
+		case "key":
+			t.Key = true
+		case "sep":
+			t.Separators.Slice = option.value
+		case "kv":
+			t.Separators.Kv = option.value
+		case "pair":
+			t.Separators.Pair = option.value
+		}
+	}
+	return t
+}
+
+type tagOption struct {
+	key   string
+	value string
+}
+
+// 按逗号分隔tag的列名和选项,选项可以是key=value的格式
+// 分隔符的选项(sep,kv,pair)的value为空时,紧跟的一个字符作为value,如pair=,表示value是逗号
+func splitTagOptions(tagString string) (name string, options []tagOption) {
+	idx := strings.Index(tagString, ",")
+	if idx < 0 {
+		return tagString, nil
+	}
+	name = tagString[:idx]
+	remain := tagString[idx+1:]
+	for len(remain) > 0 {
+		var option tagOption
+		endPos := strings.IndexAny(remain, ",=")
+		switch {
+		case endPos < 0:
+			option.key = remain
+			remain = ""
+		case remain[endPos] == ',':
+			option.key = remain[:endPos]
+			remain = remain[endPos+1:]
+		default:
+			option.key = remain[:endPos]
+			remain = remain[endPos+1:]
+			valueEndPos := strings.Index(remain, ",")
+			if valueEndPos < 0 {
+				valueEndPos = len(remain)
+			} else if valueEndPos == 0 && isSeparatorTagOption(option.key) {
+				valueEndPos = 1
+			}
+			option.value = remain[:valueEndPos]
+			remain = strings.TrimPrefix(remain[valueEndPos:], ",")
+		}
+		if option.key != "" {
+			options = append(options, option)
+		}
+	}
+	return
+}
+
+// 值是分隔符的选项,分隔符可以是逗号
+func isSeparatorTagOption(key string) bool {
+	return key == "sep" || key == "kv" || key == "pair"
+}
+
+// 一列和结构体字段的对应关系,解析表头时生成
+type columnBinding struct {
+	columnIndex int
+	columnName  string
+	fieldName   string
+	fieldIndex  []int
+	tag         csvTag
+}
+
+// 根据列名查找结构体的字段
+type fieldResolver struct {
+	typ    reflect.Type
+	option *CsvOption
+	// 列名对应的字段名
+	aliasNames map[string]string
+}
+
+func newFieldResolver(typ reflect.Type, option *CsvOption) *fieldResolver {
+	return &fieldResolver{
+		typ:    typ,
+		option: option,
+	}
+}
+
+func (r *fieldResolver) resolve(columnName string) (reflect.StructField, bool) {
+	if r.aliasNames == nil {
+		r.aliasNames = getAliasNameMap(r.typ, r.option)
+	}
+	// xxx.proto里定义的字段名可能是cfg_id
+	// 生成的xxx.pb里面的字段名会变成CfgId
+	// 如果csv里面的列名使用cfg_id也要能解析
+	if realFieldName, ok := r.aliasNames[columnName]; ok {
+		return r.typ.FieldByName(realFieldName)
+	}
+	// 嵌入的结构体的字段
+	field, ok := r.typ.FieldByName(columnName)
+	if !ok || len(field.Index) == 1 {
+		return reflect.StructField{}, false
+	}
+	if tag := parseCsvTag(field.Tag); tag.Skip || tag.Name != "" {
+		return reflect.StructField{}, false
+	}
+	return field, true
+}
+
+func (r *fieldResolver) binding(columnIndex int, columnName string) (*columnBinding, bool) {
+	field, ok := r.resolve(columnName)
+	if !ok {
+		return nil, false
+	}
+	return &columnBinding{
+		columnIndex: columnIndex,
+		columnName:  columnName,
+		fieldName:   field.Name,
+		fieldIndex:  field.Index,
+		tag:         parseCsvTag(field.Tag),
+	}, true
+}
+
+// 解析表头,绑定列和字段,在解析数据行之前调用一次
+// 表头缺少required的列时返回false
+func (lc *loadContext) bindColumns(elemType reflect.Type, headerRowIndex int, columnNames []string) ([]*columnBinding, bool) {
+	bindings, boundFields := lc.resolveColumns(elemType, headerRowIndex, columnNames)
+	return bindings, lc.checkRequired(elemType, headerRowIndex, boundFields)
+}
+
+// 绑定列和字段,不检查required的列,返回绑定的字段名
+func (lc *loadContext) resolveColumns(elemType reflect.Type, headerRowIndex int, columnNames []string) ([]*columnBinding, map[string]struct{}) {
+	resolver := newFieldResolver(elemType, lc.option)
+	var bindings []*columnBinding
+	boundFields := make(map[string]struct{})
+	for columnIndex, name := range columnNames {
+		columnName := strings.TrimSpace(name)
+		if columnName == "" {
+			// 没有列名的列,如Excel导出的csv中行尾的空列
+			continue
+		}
+		binding, ok := resolver.binding(columnIndex, columnName)
+		if !ok {
+			lc.unknownColumn(headerRowIndex, columnIndex, columnName, name)
+			continue
+		}
+		if binding.tag.Ignore {
+			boundFields[binding.fieldName] = struct{}{}
+			continue
+		}
+		if !lc.checkSettable(binding, headerRowIndex, name) {
+			continue
+		}
+		bindings = append(bindings, binding)
+		boundFields[binding.fieldName] = struct{}{}
+	}
+	return bindings, boundFields
+}
+
+// 未知的列,严格模式下返回错误
+func (lc *loadContext) unknownColumn(rowIndex, columnIndex int, columnName, value string) {
+	if _, ok := lc.option.ignoreColumns[columnName]; ok {
+		return
+	}
+	if lc.option.Strict {
+		lc.addCellError(ErrUnknownColumn, rowIndex, columnIndex, columnName, value, "")
+		return
+	}
+	lc.warn(cellLocation(rowIndex, columnIndex, columnName, value), ErrUnknownColumn)
+}
+
+// 未导出的字段无法赋值,严格模式下返回错误
+func (lc *loadContext) checkSettable(binding *columnBinding, rowIndex int, value string) bool {
+	if token.IsExported(binding.fieldName) {
+		return true
+	}
+	if lc.option.Strict {
+		lc.addCellError(ErrFieldCantSet, rowIndex, binding.columnIndex, binding.columnName, value, binding.fieldName)
+		return false
+	}
+	location := cellLocation(rowIndex, binding.columnIndex, binding.columnName, value)
+	location.FieldPath = binding.fieldName
+	lc.warn(location, ErrFieldCantSet)
+	return false
+}
+
+// 检查required的字段是否都有对应的列
+func (lc *loadContext) checkRequired(elemType reflect.Type, rowIndex int, boundFields map[string]struct{}) bool {
+	ok := true
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		tag := parseCsvTag(field.Tag)
+		if !tag.Required {
+			continue
+		}
+		if _, bound := boundFields[field.Name]; bound {
+			continue
+		}
+		columnName := tag.Name
+		if columnName == "" {
+			columnName = field.Name
+		}
+		lc.addError(&LoadError{
+			CellLocation: CellLocation{
+				Row:        rowIndex + 1,
+				ColumnName: columnName,
+				FieldPath:  field.Name,
+			},
+			Err: ErrMissingColumn,
+		})
+		ok = false
+	}
+	return ok
+}
+
+// 单元格为空时使用的默认值
+// 优先级: tag里的default > 列名注册的默认值 > 字段类型注册的默认值
+func (co *CsvOption) getDefault(binding *columnBinding, fieldType reflect.Type) (string, bool) {
+	if binding.tag.HasDefault {
+		return binding.tag.Default, true
+	}
+	if defaultString, ok := co.defaultsByColumnName[binding.columnName]; ok {
+		return defaultString, true
+	}
+	if defaultString, ok := co.defaultsByType[fieldType]; ok {
+		return defaultString, true
+	}
+	if fieldType.Kind() == reflect.Ptr {
+		// 指针类型的字段,如*int32,也可以使用int32注册的默认值
+		if defaultString, ok := co.defaultsByType[fieldType.Elem()]; ok {
+			return defaultString, true
+		}
+	}
+	return "", false
+}
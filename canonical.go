@@ -0,0 +1,217 @@
+package csv
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 把csv数据转换成规范的格式,减少Excel重新保存等操作带来的差异
+//   - 去掉单元格和表头的首尾空白,去掉空行和行尾多余的空列,每行的列数一致
+//   - 第一列(key列)保持不变,其他列按字段的声明顺序排列,未知的列保持原来的顺序放在最后
+//   - 单元格在严格模式下解析后重新格式化,如bool写成true/false,数字去掉多余的0和+号
+//   - 无法解析,或者重新格式化后含义改变的单元格(如只注册了转换接口的列)保持原样,并输出警告
+//   - 数据行按key列排序(key列和ReadCsvFromDataMap一样),key列是数字时按数值排序
+//
+// typ是一行数据对应的类型,如*pb.ItemCfg,为nil时不调整列的顺序,也不重新格式化单元格
+// 表头和数据行之间的行只去掉首尾空白
+func CanonicalizeTable(rows [][]string, typ reflect.Type, option *CsvOption) ([][]string, error) {
+	return canonicalizeTable(newLoadContext("", option), rows, typ)
+}
+
+// 读取csv文件,转换成规范的格式,规则和CanonicalizeTable一样
+func CanonicalizeCsvFile(file string, typ reflect.Type, option *CsvOption) ([][]string, error) {
+	rows, err := ReadCsvFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalizeTable(newLoadContext(file, option), rows, typ)
+}
+
+func canonicalizeTable(lc *loadContext, rows [][]string, typ reflect.Type) ([][]string, error) {
+	option := lc.option
+	if len(rows) == 0 {
+		return nil, lc.fail(ErrNoCsvHeader)
+	}
+	if len(rows) <= option.ColumnNameRowIndex {
+		return nil, lc.fail(ErrNoColumnNameHeader)
+	}
+	if option.DataBeginRowIndex < 1 {
+		return nil, lc.fail(ErrDataBeginRowIndex)
+	}
+	// 去掉首尾空白,去掉空的数据行
+	var newRows [][]string
+	columnCount := 0
+	for rowIndex, row := range rows {
+		if rowIndex >= option.DataBeginRowIndex && isBlankRow(row) {
+			continue
+		}
+		newRow := make([]string, len(row))
+		for i, cell := range row {
+			newRow[i] = strings.TrimSpace(cell)
+			if newRow[i] != "" && i >= columnCount {
+				columnCount = i + 1
+			}
+		}
+		newRows = append(newRows, newRow)
+	}
+	if columnCount == 0 {
+		return nil, lc.fail(ErrNoColumn)
+	}
+	for i, row := range newRows {
+		newRows[i] = padRow(row, columnCount)[:columnCount]
+	}
+	dataBeginRowIndex := option.DataBeginRowIndex
+	if dataBeginRowIndex > len(newRows) {
+		dataBeginRowIndex = len(newRows)
+	}
+	header := newRows[option.ColumnNameRowIndex]
+	dataRows := newRows[dataBeginRowIndex:]
+	var elemType reflect.Type
+	var bindings []*columnBinding
+	if typ != nil {
+		elemType = rowElemType(typ)
+		bindings, _ = lc.bindColumns(elemType, option.ColumnNameRowIndex, header)
+	}
+	keyIndexes, ok := lc.keyColumnIndexes(elemType, option.ColumnNameRowIndex, header, bindings)
+	if !ok {
+		return nil, lc.errs.Err()
+	}
+	// key列对应的字段类型,用于排序
+	keyTypes := make([]reflect.Type, len(keyIndexes))
+	if typ != nil {
+		for rowOffset, row := range dataRows {
+			lc.canonicalizeRow(typ, dataBeginRowIndex+rowOffset, row, bindings)
+		}
+		// 第一列不变,其他列按字段的声明顺序排列
+		order := make([]int, 0, columnCount)
+		order = append(order, 0)
+		slices.SortStableFunc(bindings, func(a, b *columnBinding) int {
+			return slices.Compare(a.fieldIndex, b.fieldIndex)
+		})
+		for _, binding := range bindings {
+			if i := slices.Index(keyIndexes, binding.columnIndex); i >= 0 {
+				keyTypes[i] = elemType.FieldByIndex(binding.fieldIndex).Type
+			}
+			if binding.columnIndex == 0 {
+				continue
+			}
+			order = append(order, binding.columnIndex)
+		}
+		for columnIndex := 1; columnIndex < columnCount; columnIndex++ {
+			if !slices.Contains(order, columnIndex) {
+				order = append(order, columnIndex)
+			}
+		}
+		for i, row := range newRows {
+			newRow := make([]string, columnCount)
+			for j, columnIndex := range order {
+				newRow[j] = row[columnIndex]
+			}
+			newRows[i] = newRow
+		}
+		// 调整顺序后key列的位置
+		for i, keyIndex := range keyIndexes {
+			keyIndexes[i] = slices.Index(order, keyIndex)
+		}
+	}
+	slices.SortStableFunc(dataRows, keyComparer(dataRows, keyIndexes, keyTypes))
+	return newRows, lc.errs.Err()
+}
+
+// 单元格解析后重新格式化,重新格式化后含义不变时才替换
+func (lc *loadContext) canonicalizeRow(typ reflect.Type, rowIndex int, row []string, bindings []*columnBinding) {
+	// 解析时的错误不作为错误返回
+	strictOption := *lc.option
+	strictOption.Strict = true
+	strictOption.Diagnostics = NopDiagnostics
+	strictOption.ErrorPolicy = ErrorPolicyCollectAll
+	for _, binding := range bindings {
+		cell := row[binding.columnIndex]
+		if cell == "" {
+			// 空单元格保持为空,不写入默认值
+			continue
+		}
+		parseCell := func(cell string) (reflect.Value, bool) {
+			parser := newLoadContext("", &strictOption)
+			object := newRowValue(typ)
+			objectElem := reflect.Indirect(object)
+			parser.convertCell(object, objectElem, binding, rowIndex, cell, false)
+			return objectElem, len(parser.errs) == 0
+		}
+		location := cellLocation(rowIndex, binding.columnIndex, binding.columnName, cell)
+		objectElem, ok := parseCell(cell)
+		if !ok {
+			lc.warn(location, ErrCanonicalize)
+			continue
+		}
+		// 单元格不为空,零值也写入,如0和false
+		canonicalCell, err := lc.formatCell(objectElem, binding, true)
+		if err != nil {
+			lc.warn(location, err)
+			continue
+		}
+		if canonicalCell == cell {
+			continue
+		}
+		newObjectElem, ok := parseCell(canonicalCell)
+		if !ok || !reflect.DeepEqual(objectElem.FieldByIndex(binding.fieldIndex).Interface(), newObjectElem.FieldByIndex(binding.fieldIndex).Interface()) {
+			lc.warn(location, ErrCanonicalize)
+			continue
+		}
+		row[binding.columnIndex] = canonicalCell
+	}
+}
+
+// 按key列依次排序,每一列的规则和keyStringComparer一样
+func keyComparer(dataRows [][]string, keyIndexes []int, keyTypes []reflect.Type) func(a, b []string) int {
+	compares := make([]func(a, b string) int, len(keyIndexes))
+	for i, keyIndex := range keyIndexes {
+		keys := make([]string, len(dataRows))
+		for j, row := range dataRows {
+			keys[j] = row[keyIndex]
+		}
+		compares[i] = keyStringComparer(keys, keyTypes[i])
+	}
+	return func(a, b []string) int {
+		for i, keyIndex := range keyIndexes {
+			if c := compares[i](a[keyIndex], b[keyIndex]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+}
+
+// key的比较函数,keyType是数字,或者keyType为nil但key都是数字时,按数值排序
+func keyStringComparer(keys []string, keyType reflect.Type) func(a, b string) int {
+	numeric := true
+	if keyType != nil {
+		switch rowElemType(keyType).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+		default:
+			numeric = false
+		}
+	}
+	if numeric {
+		for _, key := range keys {
+			if _, err := strconv.ParseFloat(key, 64); err != nil && key != "" {
+				numeric = false
+				break
+			}
+		}
+	}
+	return func(a, b string) int {
+		if numeric {
+			x, _ := strconv.ParseFloat(a, 64)
+			y, _ := strconv.ParseFloat(b, 64)
+			if c := compareOrdered(x, y); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a, b)
+	}
+}
@@ -0,0 +1,19 @@
+// csvdiff 按key比较两个版本的csv文件,输出新增,删除和修改的行,如
+//
+//	item 1001: Price 100 → 120
+//
+//	csvdiff [-json] old.csv new.csv
+//
+// 这里没有注册任何类型,直接按列名比较单元格
+// 需要按类型比较时(如007和7相同),在项目自己的main里调用csvtool.RegisterType和csvtool.DiffMain
+package main
+
+import (
+	"os"
+
+	"github.com/fish-tennis/csv/csvtool"
+)
+
+func main() {
+	os.Exit(csvtool.DiffMain(os.Args[1:]))
+}
@@ -0,0 +1,18 @@
+// csvfmt 把csv文件转换成规范的格式,减少Excel重新保存带来的git差异
+//
+//	csvfmt [-check] [-type ItemCfg -src item.go] file...
+//
+// 没有-type时只去掉空白,统一引号,按第一列排序
+// -src和-type按Go源文件里的结构体解析单元格,规范化bool和数字等写法,其他包的类型按字符串处理
+// 需要自定义的转换接口时,在项目自己的main里调用csvtool.RegisterType和csvtool.FmtMain
+package main
+
+import (
+	"os"
+
+	"github.com/fish-tennis/csv/csvtool"
+)
+
+func main() {
+	os.Exit(csvtool.FmtMain(os.Args[1:]))
+}
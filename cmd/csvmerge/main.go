@@ -0,0 +1,16 @@
+// csvmerge 三方合并csv文件,按第一列的key合并单元格,只有两边都修改的单元格才会冲突
+//
+//	csvmerge base.csv ours.csv theirs.csv
+//
+// 可以用作git的merge driver,详见csvtool.MergeMain
+package main
+
+import (
+	"os"
+
+	"github.com/fish-tennis/csv/csvtool"
+)
+
+func main() {
+	os.Exit(csvtool.MergeMain(os.Args[1:]))
+}
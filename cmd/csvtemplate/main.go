@@ -0,0 +1,118 @@
+// csvtemplate 根据Go源文件里的结构体生成空的csv模板
+//
+//	csvtemplate -src item.go -type ItemCfg -o item.csv -header 0 -data 4
+//
+// 列名,类型,注释和其他列名的规则和csv.GenerateCsvTemplate一样
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"strconv"
+
+	"github.com/fish-tennis/csv"
+)
+
+func main() {
+	src := flag.String("src", "", "Go源文件")
+	typeName := flag.String("type", "", "结构体名")
+	output := flag.String("o", "", "输出的csv文件,为空时输出到标准输出")
+	headerRowIndex := flag.Int("header", csv.DefaultOption.ColumnNameRowIndex, "表头的行索引")
+	dataRowIndex := flag.Int("data", 4, "数据行索引,表头和数据行之间填写字段类型,注释,其他列名")
+	disableProtobufAlias := flag.Bool("disable-protobuf-alias", false, "禁用protobuf的字段别名")
+	disableJsonAlias := flag.Bool("disable-json-alias", false, "禁用json的字段别名")
+	flag.Parse()
+	if *src == "" || *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	option := csv.DefaultOption
+	option.ColumnNameRowIndex = *headerRowIndex
+	option.DataBeginRowIndex = *dataRowIndex
+	option.DisableProtobufAliasName = *disableProtobufAlias
+	option.DisableJsonAliasName = *disableJsonAlias
+
+	columns, err := parseColumns(*src, *typeName, &option)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rows, err := csv.BuildCsvTemplate(columns, &option)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		err = csv.WriteCsv(os.Stdout, rows)
+	} else {
+		err = csv.WriteCsvFile(*output, rows)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// 解析Go源文件里的结构体,生成模板的列信息
+func parseColumns(src, typeName string, option *csv.CsvOption) ([]*csv.TemplateColumn, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, src, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	var structType *ast.StructType
+	ast.Inspect(file, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok && spec.Name.Name == typeName {
+			structType, _ = spec.Type.(*ast.StructType)
+			return false
+		}
+		return structType == nil
+	})
+	if structType == nil {
+		return nil, fmt.Errorf("struct %v not found in %v", typeName, src)
+	}
+	var columns []*csv.TemplateColumn
+	for _, field := range structType.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			tagString, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", fset.Position(field.Tag.Pos()), err)
+			}
+			tag = reflect.StructTag(tagString)
+		}
+		fieldTypeName := types.ExprString(field.Type)
+		names := field.Names
+		if len(names) == 0 {
+			// 嵌入的字段,字段名是类型名
+			names = []*ast.Ident{embeddedName(field.Type)}
+		}
+		for _, name := range names {
+			if column := csv.NewTemplateColumn(name.Name, fieldTypeName, tag, option); column != nil {
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns, nil
+}
+
+// 如*pb.ItemCfg -> ItemCfg
+func embeddedName(expr ast.Expr) *ast.Ident {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.IndexExpr:
+		return embeddedName(e.X)
+	case *ast.Ident:
+		return e
+	}
+	return ast.NewIdent("")
+}
@@ -1,223 +1,451 @@
 package csv
 
 import (
-	"log/slog"
+	"errors"
+	"fmt"
 	"reflect"
-	"slices"
+	"runtime/debug"
 	"strconv"
 	"strings"
 )
 
+// csv的一行数据转换成对象,转换出错的单元格保持零值,需要错误信息时使用ConvertCsvLineToValueE
 func ConvertCsvLineToValue(valueType reflect.Type, row []string, columnNames []string, option *CsvOption) reflect.Value {
-	valueElemType := valueType
-	if valueType.Kind() == reflect.Ptr {
-		valueElemType = valueType.Elem() // *pb.ItemCfg -> pb.ItemCfg
-	}
-	newObject := reflect.New(valueElemType) // 如new(pb.ItemCfg)
-	newObjectElem := newObject.Elem()
-	if valueType.Kind() == reflect.Struct {
-		newObject = newObject.Elem() // *pb.ItemCfg -> pb.ItemCfg
-	}
-	// protobuf alias name map
-	var aliasNames map[string]string
-	for columnIndex := 0; columnIndex < len(columnNames); columnIndex++ {
-		columnName := strings.TrimSpace(columnNames[columnIndex])
-		fieldString := row[columnIndex]
-		fieldVal := newObjectElem.FieldByName(columnName)
-		if !fieldVal.IsValid() {
-			if aliasNames == nil {
-				aliasNames = getAliasNameMap(valueElemType, option)
-			}
-			// xxx.proto里定义的字段名可能是cfg_id
-			// 生成的xxx.pb里面的字段名会变成CfgId
-			// 如果csv里面的列名使用cfg_id也要能解析
-			if realFieldName, ok := aliasNames[columnName]; ok {
-				fieldVal = newObjectElem.FieldByName(realFieldName)
-			}
+	value, _ := ConvertCsvLineToValueE(valueType, row, columnNames, option)
+	return value
+}
+
+// csv的一行数据转换成对象
+// 单元格的错误不会中断转换,返回的error是LoadErrors
+func ConvertCsvLineToValueE(valueType reflect.Type, row []string, columnNames []string, option *CsvOption) (reflect.Value, error) {
+	lc := newLoadContext("", option)
+	// 不知道行号
+	bindings, _ := lc.bindColumns(rowElemType(valueType), -1, columnNames)
+	value := lc.convertRow(valueType, -1, padRow(row, len(columnNames)), bindings)
+	return value, lc.errs.Err()
+}
+
+// 检查一行数据的列数
+// 空行返回nil,表示跳过这一行,列数不足时用空字符串补齐
+// 开启RejectRaggedRows时,列数不一致的行返回nil
+func (lc *loadContext) normalizeRow(rowIndex int, row []string, columnCount int) []string {
+	if isBlankRow(row) {
+		return nil
+	}
+	ragged := len(row) < columnCount
+	if !ragged {
+		// 行尾多出的空单元格不算
+		ragged = !isBlankRow(row[columnCount:])
+	}
+	if ragged {
+		if lc.option.RejectRaggedRows {
+			lc.addError(&LoadError{
+				CellLocation: CellLocation{Row: rowIndex + 1},
+				Err:          fmt.Errorf("%w: %v cells, %v columns", ErrRaggedRow, len(row), columnCount),
+			})
+			return nil
 		}
-		if fieldVal.Kind() == reflect.Ptr { // 指针类型的字段,如 Name *string
-			fieldObj := reflect.New(fieldVal.Type().Elem()) // 如new(string)
-			fieldVal.Set(fieldObj)                          // 如 obj.Name = new(string)
-			fieldVal = fieldObj.Elem()                      // 如 *(obj.Name)
+		lc.warn(CellLocation{Row: rowIndex + 1}, fmt.Errorf("%w: %v cells, %v columns", ErrRaggedRow, len(row), columnCount))
+	}
+	return padRow(row, columnCount)
+}
+
+// 列数不足时用空字符串补齐
+func padRow(row []string, columnCount int) []string {
+	if len(row) >= columnCount {
+		return row
+	}
+	newRow := make([]string, columnCount)
+	copy(newRow, row)
+	return newRow
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
 		}
-		ConvertStringToFieldValue(newObject, fieldVal, columnName, fieldString, option, false)
 	}
+	return true
+}
+
+func (lc *loadContext) convertRow(valueType reflect.Type, rowIndex int, row []string, bindings []*columnBinding) reflect.Value {
+	newObject := newRowValue(valueType)
+	lc.applyRow(newObject, rowIndex, row, bindings, false)
 	return newObject
 }
 
+// 一行数据对应的结构体类型,如*pb.ItemCfg -> pb.ItemCfg
+func rowElemType(valueType reflect.Type) reflect.Type {
+	if valueType.Kind() == reflect.Ptr {
+		return valueType.Elem()
+	}
+	return valueType
+}
+
+// 新建一行数据对应的对象
+// valueType是指针时返回指针,是结构体时返回可以赋值的结构体
+func newRowValue(valueType reflect.Type) reflect.Value {
+	if valueType.Kind() == reflect.Ptr {
+		return reflect.New(valueType.Elem()) // 如new(pb.ItemCfg)
+	}
+	return reflect.New(valueType).Elem()
+}
+
+// 把一行数据赋值给对象,object是指针或者可以赋值的结构体
+// merge为true时,object是已有的对象,空的单元格不会覆盖已有的字段
+func (lc *loadContext) applyRow(object reflect.Value, rowIndex int, row []string, bindings []*columnBinding, merge bool) {
+	objectElem := object
+	if object.Kind() == reflect.Ptr {
+		objectElem = object.Elem() // *pb.ItemCfg -> pb.ItemCfg
+	}
+	for _, binding := range bindings {
+		if lc.stopped {
+			return
+		}
+		fieldString := row[binding.columnIndex]
+		if merge && strings.TrimSpace(fieldString) == "" {
+			continue
+		}
+		lc.convertCell(object, objectElem, binding, rowIndex, fieldString, merge)
+	}
+}
+
+// 单元格的值赋值给对象的字段
+// reset为true时,先把字段重置为零值,单元格的值整体替换已有的字段,如子结构和数组
+// 转换过程中的panic(如自定义转换接口的bug)会被转换成错误,不会中断加载
+func (lc *loadContext) convertCell(object, objectElem reflect.Value, binding *columnBinding, rowIndex int, fieldString string, reset bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			lc.addCellError(&PanicError{Value: r, Stack: debug.Stack()}, rowIndex, binding.columnIndex, binding.columnName, fieldString, binding.fieldName)
+		}
+	}()
+	if binding.tag.NonEmpty && strings.TrimSpace(fieldString) == "" {
+		lc.addCellError(ErrEmptyCell, rowIndex, binding.columnIndex, binding.columnName, fieldString, binding.fieldName)
+		return
+	}
+	fieldVal := objectElem.FieldByIndex(binding.fieldIndex)
+	if strings.TrimSpace(fieldString) == "" {
+		if defaultString, ok := lc.option.getDefault(binding, fieldVal.Type()); ok {
+			fieldString = defaultString
+		}
+	}
+	if reset && fieldVal.CanSet() {
+		fieldVal.Set(reflect.Zero(fieldVal.Type()))
+	}
+	if fieldVal.Kind() == reflect.Ptr && fieldVal.CanSet() { // 指针类型的字段,如 Name *string
+		fieldObj := reflect.New(fieldVal.Type().Elem()) // 如new(string)
+		fieldVal.Set(fieldObj)                          // 如 obj.Name = new(string)
+		fieldVal = fieldObj.Elem()                      // 如 *(obj.Name)
+	}
+	option := lc.columnOption(binding)
+	if binding.tag.Strict && !option.Strict {
+		strictOption := *option
+		strictOption.Strict = true
+		option = &strictOption
+	}
+	if err := ConvertStringToFieldValue(object, fieldVal, binding.columnName, fieldString, option, false); err != nil {
+		lc.addCellError(err, rowIndex, binding.columnIndex, binding.columnName, fieldString, binding.fieldName)
+	}
+}
+
+// 列使用的设置,tag和列名注册的分隔符覆盖CsvOption里的分隔符
+func (lc *loadContext) columnOption(binding *columnBinding) *CsvOption {
+	return lc.option.withSeparators(lc.option.getSeparators(binding.columnName, binding.tag))
+}
+
 // 字段赋值,根据字段的类型,把字符串转换成对应的值
-func ConvertStringToFieldValue(object, fieldVal reflect.Value, columnName, fieldString string, option *CsvOption, isSubStruct bool) {
+// 返回的错误不带单元格的位置,子结构的错误会带上字段路径
+// isSubStruct为true时,基础类型的值会去掉转义字符,如子结构的字段Name_Fire\#Sword
+func ConvertStringToFieldValue(object, fieldVal reflect.Value, columnName, fieldString string, option *CsvOption, isSubStruct bool) error {
+	return convertSegmentToFieldValue(object, fieldVal, columnName, newCellSegment(fieldString, option.EscapeChar), option, isSubStruct)
+}
+
+// 和ConvertStringToFieldValue一样,s记录了在单元格中的位置,语法错误带有字符偏移
+func convertSegmentToFieldValue(object, fieldVal reflect.Value, columnName string, s cellSegment, option *CsvOption, isSubStruct bool) error {
 	if !fieldVal.IsValid() {
 		if _, ok := option.ignoreColumns[columnName]; !ok {
-			slog.Error("unknown column", "columnName", columnName)
+			if option.Strict {
+				return ErrUnknownColumn
+			}
+			option.diagnostics().Report(Diagnostic{
+				Severity:     SeverityWarning,
+				CellLocation: CellLocation{ColumnName: columnName},
+				Err:          ErrUnknownColumn,
+			})
 		}
-		return
+		return nil
 	}
 	if !fieldVal.CanSet() {
-		slog.Error("field cant set", "columnName", columnName)
-		return
+		if option.Strict {
+			return ErrFieldCantSet
+		}
+		option.diagnostics().Report(Diagnostic{
+			Severity:     SeverityWarning,
+			CellLocation: CellLocation{ColumnName: columnName},
+			Err:          ErrFieldCantSet,
+		})
+		return nil
 	}
-	var fieldConverter FieldConverter
+	fieldString := s.String()
 	if !isSubStruct {
-		fieldConverter = option.GetConverterByColumnName(columnName)
-	}
-	if fieldConverter != nil {
-		// 列名注册的自定义的转换接口
-		v := fieldConverter(object.Interface(), columnName, fieldString)
-		fieldVal.Set(reflect.ValueOf(v))
-	} else {
-		var convertFieldToElem bool
-		if !isSubStruct {
-			fieldConverter, convertFieldToElem = option.GetConverterByTypePtrOrStruct(fieldVal.Type())
-		}
-		if fieldConverter != nil {
-			// 类型注册的自定义的转换接口
-			v := fieldConverter(object.Interface(), columnName, fieldString)
-			if v == nil {
-				slog.Debug("field parse error", "columnName", columnName, "fieldString", fieldString)
-				return
-			}
-			if convertFieldToElem {
-				fieldVal.Set(reflect.ValueOf(v).Elem())
-			} else {
-				fieldVal.Set(reflect.ValueOf(v))
-			}
-			return
+		// 列名注册的自定义的转换接口优先,然后是类型注册的自定义的转换接口
+		converter := option.getConverterByColumnName(columnName, nil)
+		var convertToElem bool
+		if converter == nil {
+			converter, convertToElem = option.getConverterByTypePtrOrStruct(fieldVal.Type(), nil)
 		}
-		// 常规类型
-		switch fieldVal.Type().Kind() {
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			fieldVal.SetInt(Atoi64(fieldString))
-
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			fieldVal.SetUint(Atou(fieldString))
-
-		case reflect.String:
-			fieldVal.SetString(fieldString)
-
-		case reflect.Float32:
-			f32, err := strconv.ParseFloat(fieldString, 32)
-			if err != nil {
-				slog.Error("float64 convert error", "columnName", columnName, "fieldString", fieldString, "err", err)
-				break
+		if converter != nil {
+			v, err := converter(ConvertContext{
+				Object:      object.Interface(),
+				ColumnName:  columnName,
+				FieldString: fieldString,
+				FieldType:   fieldVal.Type(),
+				Option:      option,
+			})
+			if err != nil || v == nil {
+				return err
 			}
-			fieldVal.SetFloat(f32)
-
-		case reflect.Float64:
-			f64, err := strconv.ParseFloat(fieldString, 64)
+			rv, err := convertedValue(fieldVal.Type(), v, convertToElem)
 			if err != nil {
-				slog.Error("float64 convert error", "columnName", columnName, "fieldString", fieldString, "err", err)
-				break
+				return err
 			}
-			fieldVal.SetFloat(f64)
-
-		case reflect.Bool:
-			fieldVal.SetBool(strings.ToLower(fieldString) == "true" || fieldString == "1")
+			fieldVal.Set(rv)
+			return nil
+		}
+	}
+	// 常规类型
+	switch fieldVal.Type().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String, reflect.Bool:
+		if isSubStruct {
+			fieldString = unescapeValue(s, option)
+		}
+		return setBasicValue(fieldVal, fieldString, option.Strict)
 
-		case reflect.Struct:
-			if isSubStruct {
-				// csv只是简单的以分隔符来解析,无法支持多层结构,子结构的字段名容易和注册的列名冲突,所以不支持嵌套多层结构体
-				slog.Error("not support sub struct of sub struct", "columnName", columnName, "fieldString", fieldString)
-				return
+	case reflect.Struct:
+		// 如CfgId_1#Num_2,子结构的字段也可以是子结构,如Item_{CfgId_1#Num_2}#Count_3
+		// 子结构的字段名容易和注册的列名冲突,所以子结构的字段不使用注册的转换接口
+		// 字段都是基础类型时,{}是普通字符
+		pairs, err := s.withBraces(hasCompositeField(fieldVal.Type())).pairs(option.PairSeparator, option.KvSeparator)
+		if err != nil {
+			return err
+		}
+		var errs LoadErrors
+		for _, pair := range pairs {
+			key := unescapeValue(pair.key, option)
+			subFieldVal := fieldVal.FieldByName(key)
+			structField, _ := fieldVal.Type().FieldByName(key)
+			tag := parseCsvTag(structField.Tag)
+			if !subFieldVal.IsValid() || tag.Skip {
+				// csv:"-"的字段和不存在的字段一样
+				errs = append(errs, toLoadErrors(wrapFieldError(ErrUnknownField, key))...)
+				continue
 			}
-			// 如CfgId_1#Num_2
-			pairs := ParsePairString(fieldString, option)
-			for _, pair := range pairs {
-				subFieldVal := fieldVal.FieldByName(pair.Key)
-				if !subFieldVal.IsValid() {
-					slog.Error("fieldValue convert error", "columnName", columnName, "fieldString", fieldString, "fieldName", pair.Key, "fieldValue", pair.Value)
-					continue
-				}
-				if subFieldVal.Kind() == reflect.Ptr { // 指针类型的字段,如 Name *string
-					fieldObj := reflect.New(subFieldVal.Type().Elem()) // 如new(string)
-					subFieldVal.Set(fieldObj)                          // 如 obj.Name = new(string)
-					subFieldVal = fieldObj.Elem()                      // 如 *(obj.Name)
-				}
-				ConvertStringToFieldValue(fieldVal, subFieldVal, pair.Key, pair.Value, option, true)
+			if tag.Ignore {
+				// ignore的字段不赋值
+				continue
 			}
+			if subFieldVal.Kind() == reflect.Ptr { // 指针类型的字段,如 Name *string
+				fieldObj := reflect.New(subFieldVal.Type().Elem()) // 如new(string)
+				subFieldVal.Set(fieldObj)                          // 如 obj.Name = new(string)
+				subFieldVal = fieldObj.Elem()                      // 如 *(obj.Name)
+			}
+			err := convertSegmentToFieldValue(fieldVal, subFieldVal, key, pair.value, structFieldOption(structField, option), true)
+			errs = append(errs, toLoadErrors(wrapFieldError(err, key))...)
+		}
+		return errs.Err()
 
-		case reflect.Slice:
-			// 常规数组解析
-			if fieldString == "" {
-				return
+	case reflect.Slice:
+		// 常规数组解析,元素可以是子结构,数组和map,如CfgId_1#Num_2;CfgId_2#Num_3
+		if fieldString == "" {
+			return nil
+		}
+		newSlice := reflect.MakeSlice(fieldVal.Type(), 0, 0)
+		sliceElemType := fieldVal.Type().Elem()
+		converter, convertToElem := option.getConverterByTypePtrOrStruct(sliceElemType, ErrSliceElem)
+		// 元素是基础类型时,{}是普通字符,如smile :-{;ok
+		elems, err := s.withBraces(isCompositeType(rowElemType(sliceElemType))).split(option.SliceSeparator)
+		if err != nil {
+			return err
+		}
+		var errs LoadErrors
+		for i, elem := range elems {
+			if elem.begin == elem.end {
+				continue
 			}
-			newSlice := reflect.MakeSlice(fieldVal.Type(), 0, 0)
-			sliceElemType := fieldVal.Type().Elem()
-			converter, convertToElem := option.GetConverterByTypePtrOrStruct(sliceElemType)
-			if converter == nil {
-				if sliceElemType.Kind() == reflect.Struct {
-					convertToElem = true
-				} else if sliceElemType.Kind() == reflect.Ptr && sliceElemType.Elem().Kind() == reflect.Struct {
-					sliceElemType = sliceElemType.Elem()
-				}
+			path := fmt.Sprintf("[%v]", i)
+			elem, err := elem.unwrap()
+			if err != nil {
+				errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
+				continue
 			}
-			sArray := strings.Split(fieldString, option.SliceSeparator)
-			for _, str := range sArray {
-				if str == "" {
+			var rv reflect.Value
+			if converter != nil {
+				sliceElemValue, err := converter(ConvertContext{
+					Object:      object.Interface(),
+					ColumnName:  columnName,
+					FieldString: elem.String(),
+					FieldType:   sliceElemType,
+					Option:      option,
+				})
+				if err != nil {
+					errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
 					continue
 				}
-				var sliceElemValue any
-				if converter != nil {
-					sliceElemValue = converter(object.Interface(), columnName, str)
-				} else {
-					if sliceElemType.Kind() == reflect.Struct {
-						fieldObj := reflect.New(sliceElemType) // 如obj := new(Struct)
-						sliceElemValue = fieldObj.Interface()
-						subFieldVal := fieldObj.Elem() // 如 *(obj)
-						// 数组支持子结构
-						ConvertStringToFieldValue(fieldVal, subFieldVal, "", str, option, isSubStruct)
-					} else {
-						sliceElemValue = ConvertStringToRealType(sliceElemType, str)
-					}
-				}
 				if sliceElemValue == nil {
-					slog.Error("slice item parse error", "columnName", columnName, "fieldString", fieldString, "str", str)
 					continue
 				}
-				if convertToElem {
-					newSlice = reflect.Append(newSlice, reflect.ValueOf(sliceElemValue).Elem())
-				} else {
-					newSlice = reflect.Append(newSlice, reflect.ValueOf(sliceElemValue))
+				rv, err = convertedValue(sliceElemType, sliceElemValue, convertToElem)
+				if err != nil {
+					errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
+					continue
+				}
+			} else {
+				var ok bool
+				rv, ok, err = convertSegmentToElemValue(fieldVal, sliceElemType, elem, option, isSubStruct)
+				errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
+				if !ok {
+					continue
 				}
 			}
-			fieldVal.Set(newSlice)
+			newSlice = reflect.Append(newSlice, rv)
+		}
+		fieldVal.Set(newSlice)
+		return errs.Err()
 
-		case reflect.Map:
-			// 常规map解析
-			if fieldString == "" {
-				return
+	case reflect.Map:
+		// 常规map解析,value可以是子结构,数组和map,如a_{CfgId_1#Num_2}#b_{CfgId_2#Num_3}
+		if fieldString == "" {
+			return nil
+		}
+		newMap := reflect.MakeMap(fieldVal.Type())
+		fieldKeyType := fieldVal.Type().Key()
+		fieldValueType := fieldVal.Type().Elem()
+		converter, convertToElem := option.getConverterByTypePtrOrStruct(fieldValueType, ErrMapValue)
+		// value是基础类型时,{}是普通字符,如a_{b
+		pairs, err := s.withBraces(isCompositeType(rowElemType(fieldValueType))).pairs(option.PairSeparator, option.KvSeparator)
+		if err != nil {
+			return err
+		}
+		var errs LoadErrors
+		for _, pair := range pairs {
+			key := unescapeValue(pair.key, option)
+			path := fmt.Sprintf("[%v]", key)
+			fieldKeyValue, err := convertStringToRealType(fieldKeyType, key, option.Strict)
+			if err != nil {
+				errs = append(errs, toLoadErrors(wrapFieldError(fmt.Errorf("%w: %w", ErrMapKey, err), path))...)
+				continue
 			}
-			newMap := reflect.MakeMap(fieldVal.Type())
-			fieldKeyType := fieldVal.Type().Key()
-			fieldValueType := fieldVal.Type().Elem()
-			converter, convertToElem := option.GetConverterByTypePtrOrStruct(fieldValueType)
-			pairs := ParsePairString(fieldString, option)
-			for _, pair := range pairs {
-				fieldKeyValue := ConvertStringToRealType(fieldKeyType, pair.Key)
-				var fieldValueValue any
-				if converter != nil {
-					fieldValueValue = converter(object.Interface(), columnName, pair.Value)
-				} else {
-					// NOTE: map不支持子结构,分隔符容易冲突
-					fieldValueValue = ConvertStringToRealType(fieldValueType, pair.Value)
+			var rv reflect.Value
+			if converter != nil {
+				fieldValueValue, err := converter(ConvertContext{
+					Object:      object.Interface(),
+					ColumnName:  columnName,
+					FieldString: pair.value.String(),
+					FieldType:   fieldValueType,
+					Option:      option,
+				})
+				if err != nil {
+					errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
+					continue
 				}
 				if fieldValueValue == nil {
-					slog.Error("map value parse error", "columnName", columnName, "fieldString", fieldString, "pair", pair)
 					continue
 				}
-				if convertToElem {
-					newMap.SetMapIndex(reflect.ValueOf(fieldKeyValue), reflect.ValueOf(fieldValueValue).Elem())
-				} else {
-					newMap.SetMapIndex(reflect.ValueOf(fieldKeyValue), reflect.ValueOf(fieldValueValue))
+				rv, err = convertedValue(fieldValueType, fieldValueValue, convertToElem)
+				if err != nil {
+					errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
+					continue
+				}
+			} else {
+				var ok bool
+				rv, ok, err = convertSegmentToElemValue(fieldVal, fieldValueType, pair.value, option, true)
+				errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
+				if !ok {
+					continue
 				}
 			}
-			fieldVal.Set(newMap)
+			newMap.SetMapIndex(reflect.ValueOf(fieldKeyValue), rv)
+		}
+		fieldVal.Set(newMap)
+		return errs.Err()
 
-		default:
-			slog.Error("unsupported kind", "columnName", columnName, "fieldVal", fieldVal, "kind", fieldVal.Type().Kind())
-			return
+	default:
+		return fmt.Errorf("%w: %v", ErrUnsupportedKind, fieldVal.Type().Kind())
+	}
+}
+
+// 子结构的字段是子结构,数组和map时,也可以在tag里设置分隔符
+// 基础类型的字段不使用分隔符,和外层使用同样的转义规则
+func structFieldOption(field reflect.StructField, option *CsvOption) *CsvOption {
+	if !isCompositeKind(rowElemType(field.Type).Kind()) {
+		return option
+	}
+	return option.withSeparators(parseCsvTag(field.Tag).Separators)
+}
+
+// 数组的元素和map的value,返回typ类型的值,typ是指针时会分配对象
+// 基础类型转换失败时返回false,不加入数组和map,子结构,数组和map有错误时仍然返回转换后的值
+// 和读取时一样,数组的元素和map的value是[]byte时,视为字符串
+func convertSegmentToElemValue(object reflect.Value, typ reflect.Type, s cellSegment, option *CsvOption, isSubStruct bool) (reflect.Value, bool, error) {
+	v := reflect.New(typ).Elem()
+	elem := v
+	if typ.Kind() == reflect.Ptr {
+		v.Set(reflect.New(typ.Elem()))
+		elem = v.Elem()
+	}
+	if isCompositeType(elem.Type()) {
+		return v, true, convertSegmentToFieldValue(object, elem, "", s, option, isSubStruct)
+	}
+	if err := setBasicValue(elem, unescapeValue(s, option), option.Strict); err != nil {
+		return v, false, err
+	}
+	return v, true, nil
+}
+
+// 基础类型的值去掉转义字符
+func unescapeValue(s cellSegment, option *CsvOption) string {
+	return s.unescape(option.SliceSeparator, option.KvSeparator, option.PairSeparator)
+}
+
+// 结构体是否有子结构,数组([]byte除外)和map的字段
+func hasCompositeField(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.IsExported() && isCompositeType(rowElemType(field.Type)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 结构体,map,数组([]byte除外)
+func isCompositeType(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	case reflect.Slice:
+		return typ.Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// 检查转换接口返回值的类型是否可以赋值给typ
+// convertToElem为true时,v应该是指针,返回指针指向的值
+func convertedValue(typ reflect.Type, v any, convertToElem bool) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if convertToElem {
+		if rv.Kind() != reflect.Ptr || rv.IsNil() {
+			return rv, fmt.Errorf("%w: want %v, got %v", ErrConvertedType, reflect.PointerTo(typ), rv.Type())
 		}
+		rv = rv.Elem()
+	}
+	if !rv.Type().AssignableTo(typ) {
+		return rv, fmt.Errorf("%w: want %v, got %v", ErrConvertedType, typ, rv.Type())
 	}
+	return rv, nil
 }
 
 type StringPair struct {
@@ -226,120 +454,127 @@ type StringPair struct {
 }
 
 // 把K1_V1#K2_V2#K3_V3转换成StringPair数组(如[{K1,V1},{K2,V2},{K3,V3}]
-func convertPairString(pairs []*StringPair, cellString, pairSeparator, kvSeparator string) []*StringPair {
-	pairSlice := strings.Split(cellString, pairSeparator)
-	for _, pairString := range pairSlice {
-		kv := strings.SplitN(pairString, kvSeparator, 2)
-		if len(kv) != 2 {
-			continue
-		}
-		pairs = append(pairs, &StringPair{
-			Key:   kv[0],
-			Value: kv[1],
-		})
+// V是{}括起来的嵌套结构时,去掉最外层的{},{}不匹配时{}作为普通字符,需要错误信息时使用ParsePairStringE
+// 转义的分隔符不会分割,K和V保持原样(包括转义字符),V是基础类型时可以用UnescapeString去掉转义字符
+func ParsePairString(cellString string, option *CsvOption) []*StringPair {
+	if option == nil {
+		option = &DefaultOption
+	}
+	s := newCellSegment(cellString, option.EscapeChar)
+	pairs, err := parsePairSegment(s, option)
+	if err != nil {
+		pairs, _ = parsePairSegment(s.withBraces(false), option)
 	}
 	return pairs
 }
 
-// 把K1_V1#K2_V2#K3_V3转换成StringPair数组(如[{K1,V1},{K2,V2},{K3,V3}]
-func ParsePairString(cellString string, option *CsvOption) []*StringPair {
+// 和ParsePairString一样,{}不匹配时返回*SyntaxError,带有字符偏移
+func ParsePairStringE(cellString string, option *CsvOption) ([]*StringPair, error) {
 	if option == nil {
 		option = &DefaultOption
 	}
-	var pairs []*StringPair
-	return convertPairString(pairs, cellString, option.PairSeparator, option.KvSeparator)
+	return parsePairSegment(newCellSegment(cellString, option.EscapeChar), option)
 }
 
-// 解析有嵌套结构的字符串
-// 如 CfgId_1#ConsumeItems_{CfgId_1#Num_2;CfgId_2#Num_3}#Rewards_{CfgId_1#Num_1}#CountLimit_2
-// 解析成 [{CfgId,1},{ConsumeItems,CfgId_1#Num_2;CfgId_2#Num_3},{Rewards,CfgId_1#Num_1},{CountLimit,2}]
-func ParseNestString(cellString string, option *CsvOption, nestFieldNames ...string) []*StringPair {
+// 去掉分隔符,{},转义字符前面的转义字符,如Fire\#Sword -> Fire#Sword
+func UnescapeString(s string, option *CsvOption) string {
 	if option == nil {
 		option = &DefaultOption
 	}
-	var pairs []*StringPair
-	s := cellString
+	return unescapeValue(newCellSegment(s, option.EscapeChar), option)
+}
+
+func parsePairSegment(s cellSegment, option *CsvOption) ([]*StringPair, error) {
+	segmentPairs, err := s.pairs(option.PairSeparator, option.KvSeparator)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]*StringPair, 0, len(segmentPairs))
+	for _, pair := range segmentPairs {
+		pairs = append(pairs, &StringPair{
+			Key:   pair.key.String(),
+			Value: pair.value.String(),
+		})
+	}
+	return pairs, nil
+}
+
+// 解析有嵌套结构的字符串,{}可以嵌套任意层,{}不匹配时{}作为普通字符,需要错误信息时使用ParseNestStringE
+// 如 CfgId_1#ConsumeItems_{CfgId_1#Num_2;CfgId_2#Num_3}#Rewards_{CfgId_1#Num_1}#CountLimit_2
+// 解析成 [{ConsumeItems,CfgId_1#Num_2;CfgId_2#Num_3},{Rewards,CfgId_1#Num_1},{CfgId,1},{CountLimit,2}]
+// nestFieldNames的字段按nestFieldNames的顺序排在前面,和以前的版本保持一致
+func ParseNestString(cellString string, option *CsvOption, nestFieldNames ...string) []*StringPair {
+	return sortNestPairs(ParsePairString(cellString, option), nestFieldNames)
+}
+
+// 和ParseNestString一样,{}不匹配时返回*SyntaxError,带有字符偏移
+func ParseNestStringE(cellString string, option *CsvOption, nestFieldNames ...string) ([]*StringPair, error) {
+	pairs, err := ParsePairStringE(cellString, option)
+	if err != nil {
+		return nil, err
+	}
+	return sortNestPairs(pairs, nestFieldNames), nil
+}
+
+// nestFieldNames的字段按nestFieldNames的顺序排在前面
+func sortNestPairs(pairs []*StringPair, nestFieldNames []string) []*StringPair {
+	var nestPairs []*StringPair
 	for _, nestFieldName := range nestFieldNames {
-		keyword := nestFieldName + option.KvSeparator + "{" // 如ConsumeItems_{
-		beginPos := strings.Index(s, keyword)
-		if beginPos >= 0 {
-			endPos := strings.Index(s, "}")
-			if endPos > beginPos {
-				nestFieldValue := s[beginPos+len(keyword) : endPos]
-				pairs = append(pairs, &StringPair{
-					Key:   nestFieldName,
-					Value: nestFieldValue,
-				})
-				if endPos < len(s)-2 {
-					s = s[:beginPos] + s[endPos+1:]
-				} else {
-					s = s[:beginPos]
-				}
+		for i, pair := range pairs {
+			if pair != nil && pair.Key == nestFieldName {
+				nestPairs = append(nestPairs, pair)
+				pairs[i] = nil
 			}
 		}
 	}
-	return convertPairString(pairs, s, option.PairSeparator, option.KvSeparator)
+	for _, pair := range pairs {
+		if pair != nil {
+			nestPairs = append(nestPairs, pair)
+		}
+	}
+	return nestPairs
 }
 
-// Name_a#Items_{CfgId_1#Num_1;CfgId_2#Num_1};Name_b#Items_{CfgId_1#Num_2;CfgId_2#Num_2}
+// 解析有嵌套结构的数组,{}可以嵌套任意层,nestFieldNames已经不再需要
+// {}不匹配时{}作为普通字符,需要错误信息时使用ParseNestStringSliceE
+// 如 Name_a#Items_{CfgId_1#Num_1;CfgId_2#Num_1};Name_b#Items_{CfgId_1#Num_2;CfgId_2#Num_2}
 func ParseNestStringSlice(cellString string, option *CsvOption, nestFieldNames ...string) [][]*StringPair {
-	var pairsSlice [][]*StringPair
-	idCounter := 0
-	replaceKeys := make(map[int]*StringPair)
-	s := cellString
-	for _, nestFieldName := range nestFieldNames {
-		remain := s
-		for {
-			keyword := nestFieldName + option.KvSeparator + "{" // 如Items_{
-			beginPos := strings.Index(remain, keyword)
-			if beginPos < 0 {
-				break
-			}
-			// 从beginPos后面的位置查找}
-			after := remain[beginPos+len(keyword):] // 如CfgId_1#Num_1;CfgId_2#Num_1}
-			endPos := strings.Index(after, "}")
-			if endPos < 0 {
-				break
-			}
-			endPos += beginPos + len(keyword)
-			nestFieldValue := remain[beginPos+len(keyword) : endPos] // 如CfgId_1#Num_1;CfgId_2#Num_1
-			idCounter++
-			replaceKeys[idCounter] = &StringPair{
-				Key:   nestFieldName,
-				Value: nestFieldValue,
-			}
-			old := keyword + nestFieldValue + "}"
-			// Items_{CfgId_1#Num_1;CfgId_2#Num_1}替换为Items_idCounter
-			s = strings.Replace(s, old, nestFieldName+option.KvSeparator+strconv.Itoa(idCounter), 1)
-			remain = remain[endPos+1:]
-		}
-	}
-	// Name_a#Items_1;Name_b#Items_2
-	elemSlice := strings.Split(s, option.SliceSeparator)
-	for _, elem := range elemSlice {
-		var pairs []*StringPair
-		pairSlice := strings.Split(elem, option.PairSeparator)
-		for _, pairString := range pairSlice {
-			kv := strings.SplitN(pairString, option.KvSeparator, 2)
-			if len(kv) != 2 {
-				continue
-			}
-			if slices.Contains(nestFieldNames, kv[0]) {
-				// 还原替换值
-				id := Atoi(kv[1])
-				if pair, ok := replaceKeys[id]; ok {
-					pairs = append(pairs, pair)
-				}
-			} else {
-				pairs = append(pairs, &StringPair{
-					Key:   kv[0],
-					Value: kv[1],
-				})
-			}
+	if option == nil {
+		option = &DefaultOption
+	}
+	s := newCellSegment(cellString, option.EscapeChar)
+	pairsSlice, err := parsePairsSliceSegment(s, option)
+	if err != nil {
+		pairsSlice, _ = parsePairsSliceSegment(s.withBraces(false), option)
+	}
+	return pairsSlice
+}
+
+// 和ParseNestStringSlice一样,{}不匹配时返回*SyntaxError,带有字符偏移,不需要nestFieldNames
+func ParseNestStringSliceE(cellString string, option *CsvOption) ([][]*StringPair, error) {
+	if option == nil {
+		option = &DefaultOption
+	}
+	return parsePairsSliceSegment(newCellSegment(cellString, option.EscapeChar), option)
+}
+
+func parsePairsSliceSegment(s cellSegment, option *CsvOption) ([][]*StringPair, error) {
+	elems, err := s.split(option.SliceSeparator)
+	if err != nil {
+		return nil, err
+	}
+	pairsSlice := make([][]*StringPair, 0, len(elems))
+	for _, elem := range elems {
+		if elem, err = elem.unwrap(); err != nil {
+			return nil, err
+		}
+		pairs, err := parsePairSegment(elem, option)
+		if err != nil {
+			return nil, err
 		}
 		pairsSlice = append(pairsSlice, pairs)
 	}
-	return pairsSlice
+	return pairsSlice, nil
 }
 
 func Atoi(s string) int {
@@ -367,78 +602,151 @@ func Atou(s string) uint64 {
 }
 
 // 支持int,float,string,[]byte,complex,bool
+// 转换失败时返回零值,不支持的类型返回nil
 func ConvertStringToRealType(typ reflect.Type, s string) any {
+	v, _ := convertStringToRealType(typ, s, false)
+	return v
+}
+
+// 返回值的类型就是typ
+// 转换失败时,除了不支持的类型,仍然会返回零值
+func convertStringToRealType(typ reflect.Type, s string, strict bool) (any, error) {
+	v := reflect.New(typ).Elem()
+	if err := setBasicValue(v, s, strict); err != nil {
+		if errors.Is(err, ErrUnsupportedKind) {
+			return nil, err
+		}
+		return v.Interface(), err
+	}
+	return v.Interface(), nil
+}
+
+// 把字符串转换成基础类型(int,uint,float,complex,string,[]byte,bool)的值
+// 空字符串视为零值
+// 非strict模式下,整数格式错误时为0,超出类型范围时截断,bool只识别true和1
+// strict模式下,数字格式错误,超出类型范围,无法识别的bool都会返回错误
+func setBasicValue(v reflect.Value, s string, strict bool) error {
+	typ := v.Type()
 	switch typ.Kind() {
-	case reflect.Int:
-		return Atoi(s)
-	case reflect.Int8:
-		return int8(Atoi(s))
-	case reflect.Int16:
-		return int16(Atoi(s))
-	case reflect.Int32:
-		return int32(Atoi(s))
-	case reflect.Int64:
-		return Atoi64(s)
-	case reflect.Uint:
-		return uint(Atou(s))
-	case reflect.Uint8:
-		return uint8(Atou(s))
-	case reflect.Uint16:
-		return uint16(Atou(s))
-	case reflect.Uint32:
-		return uint32(Atou(s))
-	case reflect.Uint64:
-		return Atou(s)
-	case reflect.Float32:
-		f, _ := strconv.ParseFloat(s, 32)
-		return float32(f)
-	case reflect.Float64:
-		f, _ := strconv.ParseFloat(s, 64)
-		return f
-	case reflect.Complex64:
-		c, _ := strconv.ParseComplex(s, 64)
-		return c
-	case reflect.Complex128:
-		c, _ := strconv.ParseComplex(s, 128)
-		return c
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !strict {
+			v.SetInt(Atoi64(s))
+			return nil
+		}
+		if strings.TrimSpace(s) == "" {
+			v.SetInt(0)
+			return nil
+		}
+		i, err := strconv.ParseInt(s, 10, typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !strict {
+			v.SetUint(Atou(s))
+			return nil
+		}
+		if strings.TrimSpace(s) == "" {
+			v.SetUint(0)
+			return nil
+		}
+		u, err := strconv.ParseUint(s, 10, typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		if strings.TrimSpace(s) == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	case reflect.Complex64, reflect.Complex128:
+		if strings.TrimSpace(s) == "" {
+			v.SetComplex(0)
+			return nil
+		}
+		c, err := strconv.ParseComplex(s, typ.Bits())
+		if err != nil && strict {
+			return err
+		}
+		v.SetComplex(c)
+
 	case reflect.String:
-		return s
+		v.SetString(s)
+
 	case reflect.Bool:
-		return strings.ToLower(s) == "true" || s == "1"
+		switch strings.ToLower(s) {
+		case "true", "1":
+			v.SetBool(true)
+		case "false", "0", "":
+			v.SetBool(false)
+		default:
+			if strict {
+				return ErrInvalidBool
+			}
+			v.SetBool(false)
+		}
+
 	case reflect.Slice:
 		// []byte
-		if typ.Elem().Kind() == reflect.Uint8 {
-			return []byte(s)
+		if typ.Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("%w: %v", ErrUnsupportedKind, typ)
 		}
+		v.SetBytes([]byte(s))
+
 	default:
-		slog.Error("unsupported kind", "kind", typ.Kind())
+		return fmt.Errorf("%w: %v", ErrUnsupportedKind, typ.Kind())
 	}
 	return nil
 }
 
+// 列名对应的字段名
+// 优先级: csv tag里的列名 > 字段名 > protobuf的字段别名 > json的字段别名
+// 有csv tag列名的字段只能用这个列名,csv:"-"的字段不对应任何列
 func getAliasNameMap(elemType reflect.Type, option *CsvOption) map[string]string {
 	aliasNames := make(map[string]string)
-	if option.DisableProtobufAliasName && option.DisableJsonAliasName {
-		return aliasNames
-	}
-	for i := 0; i < elemType.NumField(); i++ {
-		fieldTyp := elemType.Field(i)
-		if !fieldTyp.IsExported() {
-			continue
-		}
-		if !option.DisableProtobufAliasName {
-			name := getProtobufNameFromStructTag(fieldTyp.Tag)
-			if name == "" {
+	// 按优先级从低到高赋值,优先级高的覆盖优先级低的
+	for pass := 0; pass < 4; pass++ {
+		for i := 0; i < elemType.NumField(); i++ {
+			fieldTyp := elemType.Field(i)
+			tag := parseCsvTag(fieldTyp.Tag)
+			if tag.Skip {
 				continue
 			}
-			aliasNames[name] = fieldTyp.Name
-		}
-		if !option.DisableJsonAliasName {
-			name := getJsonNameFromStructTag(fieldTyp.Tag)
-			if name == "" {
-				continue
+			var name string
+			switch pass {
+			case 0:
+				if fieldTyp.IsExported() && tag.Name == "" && !option.DisableJsonAliasName {
+					if name = getJsonNameFromStructTag(fieldTyp.Tag); name == "-" {
+						name = ""
+					}
+				}
+			case 1:
+				if fieldTyp.IsExported() && tag.Name == "" && !option.DisableProtobufAliasName {
+					name = getProtobufNameFromStructTag(fieldTyp.Tag)
+				}
+			case 2:
+				// 未导出的字段也可以对应列,解析表头时输出ErrFieldCantSet
+				if tag.Name == "" {
+					name = fieldTyp.Name
+				}
+			case 3:
+				if fieldTyp.IsExported() {
+					name = tag.Name
+				}
+			}
+			if name != "" {
+				aliasNames[name] = fieldTyp.Name
 			}
-			aliasNames[name] = fieldTyp.Name
 		}
 	}
 	return aliasNames
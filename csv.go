@@ -2,24 +2,74 @@ package csv
 
 import (
 	"encoding/csv"
-	"errors"
+	"fmt"
 	"os"
 	"reflect"
 	"slices"
+	"strconv"
+	"strings"
 )
 
 // 默认csv设置
 var DefaultOption = CsvOption{
-	ColumnNameRowIndex: 0,
-	DataBeginRowIndex:  1, // csv行索引
-	SliceSeparator:     ";",
-	KvSeparator:        "_",
-	PairSeparator:      "#",
+	ColumnNameRowIndex:      0,
+	DataBeginRowIndex:       1, // csv行索引
+	ObjectDataBeginRowIndex: 1,
+	SliceSeparator:          ";",
+	KvSeparator:             "_",
+	PairSeparator:           "#",
+	EscapeChar:              "\\",
+	OverlayDeleteColumnName: "#delete",
+	OverlayEmptyValue:       "#empty",
 }
 
 // 字段转换接口
 type FieldConverter func(obj any, columnName, fieldStr string) any
 
+// 包装成FieldConverterE,返回nil时返回nilErr
+func (c FieldConverter) toE(nilErr error) FieldConverterE {
+	return func(ctx ConvertContext) (any, error) {
+		v := c(ctx.Object, ctx.ColumnName, ctx.FieldString)
+		if v == nil {
+			return nil, nilErr
+		}
+		return v, nil
+	}
+}
+
+// FieldConverterE的参数
+type ConvertContext struct {
+	// 当前行对应的对象,如*pb.ItemCfg
+	Object any
+	// 列名,子结构中是字段名
+	ColumnName string
+	// 需要转换的字符串,数组和map中是单个元素的字符串
+	FieldString string
+	// 需要转换成的类型
+	FieldType reflect.Type
+	Option    *CsvOption
+}
+
+// 可以返回错误的字段转换接口
+// 返回的错误会带上单元格的位置,返回(nil,nil)表示不赋值
+// 返回值的类型必须可以赋值给字段,否则也会返回错误
+type FieldConverterE func(ctx ConvertContext) (any, error)
+
+// 字段格式化接口,把字段的值转换成csv的字符串,是FieldConverter的逆过程
+// 如把Color枚举写成Red,用于写入csv
+type FieldFormatter func(ctx FormatContext) (string, error)
+
+// FieldFormatter的参数
+type FormatContext struct {
+	// 列名,数组和map中也是所在的列名
+	ColumnName string
+	// 需要格式化的值,数组和map中是单个元素的值
+	FieldValue any
+	// 值的类型
+	FieldType reflect.Type
+	Option    *CsvOption
+}
+
 type CsvOption struct {
 	// 数据行索引(>=1)
 	DataBeginRowIndex int
@@ -63,14 +113,84 @@ type CsvOption struct {
 	// }
 	PairSeparator string
 
+	// 转义字符,默认\,为空时不转义
+	// 数组,map,子结构里的值包含分隔符,{}或者转义字符时,在前面加上转义字符,如Name_Fire\#Sword
+	// 转义字符后面不是这些特殊字符时,转义字符保持原样,如C:\dir
+	EscapeChar string
+
+	// map表的key列名,多个列时是组合key,为空时使用csv:",key"的字段,都没有时固定第一列是key
+	// 组合key可以对应结构体的key(按列名查找字段),如map[SkillLevelKey]V,或者嵌套的map,如map[SkillId]map[Level]V
+	KeyColumnNames []string
+
+	// map表中key重复时的处理方式,默认返回错误并保留先出现的行
+	DuplicateKeyPolicy DuplicateKeyPolicy
+
+	// 严格模式,默认不开启
+	// 开启后,数字格式错误,数字超出字段类型的范围,无法识别的bool(true,false,1,0),未知的列,无法赋值的字段都会返回错误
+	// 例外: 空单元格(包括只有空白的单元格和子结构里的空值,如CfgId_)仍然视为零值,整数和浮点数也不报错,
+	// 因为写入时零值写成空单元格;需要拒绝空单元格时用csv:",nonempty",需要其他值时用csv:",default=..."
+	Strict bool
+
+	// 是否拒绝列数和列名数量不一致的行,默认不拒绝
+	// 默认情况下,列数不足的行用空字符串补齐,多出的列忽略,并输出警告
+	// 行尾多出的空单元格(Excel导出的csv中常见)不算列数不一致
+	RejectRaggedRows bool
+
+	// 出现错误时的处理方式,默认收集所有错误,并返回解析的数据
+	ErrorPolicy ErrorPolicy
+
+	// ErrorPolicy为ErrorPolicyMaxErrors时,收集到的错误数量达到MaxErrors后停止加载,<=0表示不限制
+	MaxErrors int
+
+	// 覆盖表中标记删除的列名,这一列的值为true时删除key对应的行,为空时不支持删除
+	OverlayDeleteColumnName string
+
+	// 覆盖表中表示清空字段的单元格,字段按空单元格处理(如使用默认值),为空时不支持清空
+	// 覆盖表中的空单元格表示不修改
+	OverlayEmptyValue string
+
+	// 诊断信息(错误,警告)的输出接口,默认只把警告输出到slog.Default(),错误只作为error返回
+	// 可以使用NewSlogDiagnostics,DiagnosticsCollector,NopDiagnostics
+	Diagnostics Diagnostics
+
 	// 自定义转换函数
 	// 把csv的字符串转换成其他对象 以列名作为关键字
 	customFieldConvertersByColumnName map[string]FieldConverter
 	// 把csv的字符串转换成其他对象 以字段类型作为关键字
 	customFieldConvertersByType map[reflect.Type]FieldConverter
+	// 可以返回错误的转换函数,优先于FieldConverter
+	customFieldConvertersEByColumnName map[string]FieldConverterE
+	customFieldConvertersEByType       map[reflect.Type]FieldConverterE
+	// 自定义格式化函数,写入csv时把对象转换成字符串
+	customFieldFormattersByColumnName map[string]FieldFormatter
+	customFieldFormattersByType       map[reflect.Type]FieldFormatter
 
 	// 忽略的列名,如单纯的注释列
 	ignoreColumns map[string]struct{}
+
+	// 单元格为空时使用的默认值,和单元格一样解析
+	defaultsByColumnName map[string]string
+	defaultsByType       map[reflect.Type]string
+
+	// 列名对应的分隔符
+	separatorsByColumnName map[string]Separators
+}
+
+// 字段的分隔符,为空时使用CsvOption里的分隔符
+type Separators struct {
+	// 数组分隔符,对应CsvOption.SliceSeparator
+	Slice string
+	// Key-Value分隔符,对应CsvOption.KvSeparator
+	Kv string
+	// 不同Key-Value之间的分隔符,对应CsvOption.PairSeparator
+	Pair string
+}
+
+func (co *CsvOption) diagnostics() Diagnostics {
+	if co.Diagnostics == nil {
+		return defaultDiagnostics
+	}
+	return co.Diagnostics
 }
 
 // 注册列名对应的转换接口
@@ -122,6 +242,176 @@ func (co *CsvOption) GetConverterByTypePtrOrStruct(typ reflect.Type) (converter
 	return
 }
 
+// 注册列名对应的可以返回错误的转换接口
+func (co *CsvOption) RegisterConverterEByColumnName(columnName string, converter FieldConverterE) *CsvOption {
+	if co.customFieldConvertersEByColumnName == nil {
+		co.customFieldConvertersEByColumnName = make(map[string]FieldConverterE)
+	}
+	co.customFieldConvertersEByColumnName[columnName] = converter
+	return co
+}
+
+func (co *CsvOption) GetConverterEByColumnName(columnName string) FieldConverterE {
+	if co.customFieldConvertersEByColumnName == nil {
+		return nil
+	}
+	return co.customFieldConvertersEByColumnName[columnName]
+}
+
+// 注册类型对应的可以返回错误的转换接口
+func (co *CsvOption) RegisterConverterEByType(typ reflect.Type, converter FieldConverterE) *CsvOption {
+	if co.customFieldConvertersEByType == nil {
+		co.customFieldConvertersEByType = make(map[reflect.Type]FieldConverterE)
+	}
+	co.customFieldConvertersEByType[typ] = converter
+	return co
+}
+
+func (co *CsvOption) GetConverterEByType(typ reflect.Type) FieldConverterE {
+	if co.customFieldConvertersEByType == nil {
+		return nil
+	}
+	return co.customFieldConvertersEByType[typ]
+}
+
+// 查找列名对应的转换接口,FieldConverterE优先
+// FieldConverter会被包装成FieldConverterE,返回nil时的错误是nilErr
+func (co *CsvOption) getConverterByColumnName(columnName string, nilErr error) FieldConverterE {
+	if converter := co.GetConverterEByColumnName(columnName); converter != nil {
+		return converter
+	}
+	if converter := co.GetConverterByColumnName(columnName); converter != nil {
+		return converter.toE(nilErr)
+	}
+	return nil
+}
+
+// 查找类型对应的转换接口,FieldConverterE优先,规则和GetConverterByTypePtrOrStruct一样
+// FieldConverter会被包装成FieldConverterE,返回nil时的错误是nilErr
+func (co *CsvOption) getConverterByTypePtrOrStruct(typ reflect.Type, nilErr error) (converter FieldConverterE, convertToElem bool) {
+	getConverter := func(typ reflect.Type) FieldConverterE {
+		if converter := co.GetConverterEByType(typ); converter != nil {
+			return converter
+		}
+		if converter := co.GetConverterByType(typ); converter != nil {
+			return converter.toE(nilErr)
+		}
+		return nil
+	}
+	converter = getConverter(typ)
+	if converter == nil && typ.Kind() == reflect.Struct {
+		converter = getConverter(reflect.PointerTo(typ))
+		// 注册的是指针类型,转换后,需要把ptr转换成elem
+		convertToElem = converter != nil
+	}
+	return
+}
+
+// 注册列名对应的格式化接口,写入csv时使用,和RegisterConverterByColumnName对应
+func (co *CsvOption) RegisterFormatterByColumnName(columnName string, formatter FieldFormatter) *CsvOption {
+	if co.customFieldFormattersByColumnName == nil {
+		co.customFieldFormattersByColumnName = make(map[string]FieldFormatter)
+	}
+	co.customFieldFormattersByColumnName[columnName] = formatter
+	return co
+}
+
+func (co *CsvOption) GetFormatterByColumnName(columnName string) FieldFormatter {
+	if co.customFieldFormattersByColumnName == nil {
+		return nil
+	}
+	return co.customFieldFormattersByColumnName[columnName]
+}
+
+// 注册类型对应的格式化接口,写入csv时使用,和RegisterConverterByType对应
+func (co *CsvOption) RegisterFormatterByType(typ reflect.Type, formatter FieldFormatter) *CsvOption {
+	if co.customFieldFormattersByType == nil {
+		co.customFieldFormattersByType = make(map[reflect.Type]FieldFormatter)
+	}
+	co.customFieldFormattersByType[typ] = formatter
+	return co
+}
+
+func (co *CsvOption) GetFormatterByType(typ reflect.Type) FieldFormatter {
+	if co.customFieldFormattersByType == nil {
+		return nil
+	}
+	return co.customFieldFormattersByType[typ]
+}
+
+// 查找类型对应的格式化接口,如果typ没有注册,但是注册了同类型的Ptr,则会返回Ptr类型的FieldFormatter,同时formatPtr返回true
+func (co *CsvOption) getFormatterByTypePtrOrElem(typ reflect.Type) (formatter FieldFormatter, formatPtr bool) {
+	if formatter = co.GetFormatterByType(typ); formatter != nil {
+		return
+	}
+	formatter = co.GetFormatterByType(reflect.PointerTo(typ))
+	formatPtr = formatter != nil
+	return
+}
+
+// 注册列名对应的默认值,单元格为空时使用,和单元格一样解析
+// 字段的tag里设置的默认值优先,如 `csv:",default=100"`
+func (co *CsvOption) RegisterDefaultByColumnName(columnName string, defaultString string) *CsvOption {
+	if co.defaultsByColumnName == nil {
+		co.defaultsByColumnName = make(map[string]string)
+	}
+	co.defaultsByColumnName[columnName] = defaultString
+	return co
+}
+
+// 注册字段类型对应的默认值,单元格为空时使用,和单元格一样解析
+// 列名注册的默认值优先
+func (co *CsvOption) RegisterDefaultByType(typ reflect.Type, defaultString string) *CsvOption {
+	if co.defaultsByType == nil {
+		co.defaultsByType = make(map[reflect.Type]string)
+	}
+	co.defaultsByType[typ] = defaultString
+	return co
+}
+
+// 注册列名对应的分隔符,如坐标列1.5,2.0可以使用Separators{Slice: ","}
+// 字段的tag里设置的分隔符优先,如 `csv:",sep=|,kv=:,pair=,"`
+func (co *CsvOption) RegisterSeparatorsByColumnName(columnName string, separators Separators) *CsvOption {
+	if co.separatorsByColumnName == nil {
+		co.separatorsByColumnName = make(map[string]Separators)
+	}
+	co.separatorsByColumnName[columnName] = separators
+	return co
+}
+
+// 列使用的分隔符,tag里的分隔符优先,然后是列名注册的分隔符
+func (co *CsvOption) getSeparators(columnName string, tag csvTag) Separators {
+	separators := co.separatorsByColumnName[columnName]
+	if tag.Separators.Slice != "" {
+		separators.Slice = tag.Separators.Slice
+	}
+	if tag.Separators.Kv != "" {
+		separators.Kv = tag.Separators.Kv
+	}
+	if tag.Separators.Pair != "" {
+		separators.Pair = tag.Separators.Pair
+	}
+	return separators
+}
+
+// 使用separators覆盖分隔符的设置,没有需要覆盖的分隔符时返回co
+func (co *CsvOption) withSeparators(separators Separators) *CsvOption {
+	if separators == (Separators{}) {
+		return co
+	}
+	option := *co
+	if separators.Slice != "" {
+		option.SliceSeparator = separators.Slice
+	}
+	if separators.Kv != "" {
+		option.KvSeparator = separators.Kv
+	}
+	if separators.Pair != "" {
+		option.PairSeparator = separators.Pair
+	}
+	return &option
+}
+
 // 设置需要忽略的列名,如单纯的注释列
 func (co *CsvOption) IgnoreColumn(columnNames ...string) {
 	if co.ignoreColumns == nil {
@@ -132,6 +422,47 @@ func (co *CsvOption) IgnoreColumn(columnNames ...string) {
 	}
 }
 
+// map表中key重复时的处理方式
+type DuplicateKeyPolicy int
+
+const (
+	// 返回DuplicateKeyError,保留先出现的行
+	DuplicateKeyReject DuplicateKeyPolicy = iota
+	// 保留先出现的行
+	DuplicateKeyKeepFirst
+	// 保留后出现的行
+	DuplicateKeyKeepLast
+	// 后出现的行中非空的单元格覆盖先出现的行
+	DuplicateKeyMerge
+)
+
+func (p DuplicateKeyPolicy) String() string {
+	switch p {
+	case DuplicateKeyReject:
+		return "Reject"
+	case DuplicateKeyKeepFirst:
+		return "KeepFirst"
+	case DuplicateKeyKeepLast:
+		return "KeepLast"
+	case DuplicateKeyMerge:
+		return "Merge"
+	}
+	return strconv.Itoa(int(p))
+}
+
+// 出现错误时的处理方式
+// 停止加载时,出错的那一行不会加入map或slice,之前加载的数据仍然保留
+type ErrorPolicy int
+
+const (
+	// 收集所有错误,并返回解析的数据
+	ErrorPolicyCollectAll ErrorPolicy = iota
+	// 出现第一个错误时停止加载
+	ErrorPolicyStopOnFirst
+	// 收集CsvOption.MaxErrors个错误后停止加载
+	ErrorPolicyMaxErrors
+)
+
 type IntOrString interface {
 	~int | ~int8 | ~int16 | ~int32 | ~int64 |
 		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~string
@@ -144,7 +475,7 @@ func ReadCsvFileMap[M ~map[K]V, K IntOrString, V any](file string, m M, option *
 	if readErr != nil {
 		return readErr
 	}
-	return ReadCsvFromDataMap(rows, m, option)
+	return readCsvFromDataMap(newLoadContext(file, option), rows, m)
 }
 
 // csv数据转换成slice
@@ -154,7 +485,7 @@ func ReadCsvFileSlice[Slice ~[]V, V any](file string, s Slice, option *CsvOption
 	if readErr != nil {
 		return s, readErr
 	}
-	return ReadCsvFromDataSlice(rows, s, option)
+	return readCsvFromDataSlice(newLoadContext(file, option), rows, s)
 }
 
 // key-value格式的csv数据给对象赋值
@@ -164,7 +495,7 @@ func ReadCsvFileObject[V any](file string, v V, option *CsvOption) error {
 	if readErr != nil {
 		return readErr
 	}
-	return ReadCsvFromDataObject(rows, v, option)
+	return readCsvFromDataObject(newLoadContext(file, option), rows, v)
 }
 
 func ReadCsvFile(file string) ([][]string, error) {
@@ -173,117 +504,222 @@ func ReadCsvFile(file string) ([][]string, error) {
 		return nil, err
 	}
 	defer f.Close()
-	return csv.NewReader(f).ReadAll()
+	reader := csv.NewReader(f)
+	// Excel导出的csv,每行的列数可能不一样(如行尾的空单元格),由Read*接口处理
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
 }
 
 // csv数据转换成map
 // V支持proto.Message和普通struct结构
+// 单元格的错误不会中断加载,返回的error是LoadErrors
 func ReadCsvFromDataMap[M ~map[K]V, K IntOrString, V any](rows [][]string, m M, option *CsvOption) error {
-	if option == nil {
-		option = &DefaultOption
+	return readCsvFromDataMap(newLoadContext("", option), rows, m)
+}
+
+func readCsvFromDataMap[M ~map[K]V, K IntOrString, V any](lc *loadContext, rows [][]string, m M) error {
+	return lc.readMap(rows, reflect.ValueOf(m))
+}
+
+// csv数据转换成map,key可以是组合key
+// K是基础类型或者结构体(组合key),V可以是嵌套的map,如map[int32]map[int32]*pb.SkillLevelCfg
+// key列见CsvOption.KeyColumnNames
+func ReadCsvFromDataKeyMap[M ~map[K]V, K comparable, V any](rows [][]string, m M, option *CsvOption) error {
+	return newLoadContext("", option).readMap(rows, reflect.ValueOf(m))
+}
+
+// csv文件转换成map,key可以是组合key,规则和ReadCsvFromDataKeyMap一样
+func ReadCsvFileKeyMap[M ~map[K]V, K comparable, V any](file string, m M, option *CsvOption) error {
+	rows, readErr := ReadCsvFile(file)
+	if readErr != nil {
+		return readErr
 	}
+	return newLoadContext(file, option).readMap(rows, reflect.ValueOf(m))
+}
+
+// mVal是map或者嵌套的map
+func (lc *loadContext) readMap(rows [][]string, mVal reflect.Value) error {
+	option := lc.option
 	if len(rows) == 0 {
-		return errors.New("no csv header")
+		return lc.fail(ErrNoCsvHeader)
 	}
 	if len(rows) <= option.ColumnNameRowIndex {
-		return errors.New("no column name header")
+		return lc.fail(ErrNoColumnNameHeader)
 	}
 	columnNames := rows[option.ColumnNameRowIndex]
 	if len(columnNames) == 0 {
-		return errors.New("no column")
+		return lc.fail(ErrNoColumn)
 	}
 	if option.DataBeginRowIndex < 1 {
-		return errors.New("DataBeginRowIndex must >=1")
-	}
-	mType := reflect.TypeOf(m)
-	mVal := reflect.ValueOf(m)
-	keyType := mType.Key()    // key type of m, 如int
-	valueType := mType.Elem() // value type of m, 如*pb.ItemCfg or pb.ItemCfg
-	for rowIndex := option.DataBeginRowIndex; rowIndex < len(rows); rowIndex++ {
-		row := rows[rowIndex]
-		// 固定第一列是key
-		key := ConvertStringToRealType(keyType, row[0])
-		value := ConvertCsvLineToValue(valueType, row, columnNames, option)
-		mVal.SetMapIndex(reflect.ValueOf(key), value)
+		return lc.fail(ErrDataBeginRowIndex)
 	}
-	return nil
+	keyTypes, valueType := mapKeyTypes(mVal.Type()) // value type of m, 如*pb.ItemCfg or pb.ItemCfg
+	bindings, ok := lc.bindColumns(rowElemType(valueType), option.ColumnNameRowIndex, columnNames)
+	if !ok {
+		return lc.errs.Err()
+	}
+	keyBindings, ok := lc.bindKeyColumns(rowElemType(valueType), keyTypes, option.ColumnNameRowIndex, columnNames, bindings)
+	if !ok {
+		return lc.errs.Err()
+	}
+	firstKeyColumn := keyBindings[0].columns[0]
+	// key第一次出现的行索引
+	keyRows := make(map[string]int)
+	for rowIndex := option.DataBeginRowIndex; rowIndex < len(rows) && !lc.stopped; rowIndex++ {
+		row := lc.normalizeRow(rowIndex, rows[rowIndex], len(columnNames))
+		if row == nil {
+			continue
+		}
+		keyVals, ok := lc.convertKeys(rowIndex, row, keyBindings)
+		if !ok {
+			continue
+		}
+		// 组合key的每一层都可以比较
+		var keyParts []string
+		for _, keyVal := range keyVals {
+			keyParts = append(keyParts, fmt.Sprintf("%#v", keyVal.Interface()))
+		}
+		key := strings.Join(keyParts, "\x00")
+		targetMap := innerMap(mVal, keyVals)
+		keyVal := keyVals[len(keyVals)-1]
+		if firstRowIndex, ok := keyRows[key]; ok {
+			duplicateKeyErr := &DuplicateKeyError{Key: keyString(row, keyBindings), FirstRow: firstRowIndex + 1}
+			location := cellLocation(rowIndex, firstKeyColumn.columnIndex, firstKeyColumn.columnName, row[firstKeyColumn.columnIndex])
+			if option.DuplicateKeyPolicy == DuplicateKeyReject {
+				lc.addCellError(duplicateKeyErr, rowIndex, location.Column, location.ColumnName, location.Value, "")
+				continue
+			}
+			lc.warn(location, duplicateKeyErr)
+			switch option.DuplicateKeyPolicy {
+			case DuplicateKeyKeepFirst:
+				continue
+			case DuplicateKeyMerge:
+				value := targetMap.MapIndex(keyVal)
+				if valueType.Kind() != reflect.Ptr {
+					// map的value不能直接赋值,复制一份
+					copyValue := reflect.New(valueType).Elem()
+					copyValue.Set(value)
+					value = copyValue
+				}
+				lc.applyRow(value, rowIndex, row, bindings, true)
+				if lc.stopped {
+					break
+				}
+				targetMap.SetMapIndex(keyVal, value)
+				continue
+			}
+		} else {
+			keyRows[key] = rowIndex
+		}
+		value := lc.convertRow(valueType, rowIndex, row, bindings)
+		if lc.stopped {
+			break
+		}
+		targetMap.SetMapIndex(keyVal, value)
+	}
+	return lc.errs.Err()
 }
 
 // csv数据转换成slice
 // V支持proto.Message和普通struct结构
+// 单元格的错误不会中断加载,返回的error是LoadErrors
 func ReadCsvFromDataSlice[Slice ~[]V, V any](rows [][]string, s Slice, option *CsvOption) (Slice, error) {
-	if option == nil {
-		option = &DefaultOption
-	}
+	return readCsvFromDataSlice(newLoadContext("", option), rows, s)
+}
+
+func readCsvFromDataSlice[Slice ~[]V, V any](lc *loadContext, rows [][]string, s Slice) (Slice, error) {
+	option := lc.option
 	if len(rows) == 0 {
-		return s, errors.New("no csv header")
+		return s, lc.fail(ErrNoCsvHeader)
 	}
 	if len(rows) <= option.ColumnNameRowIndex {
-		return s, errors.New("no column name header")
+		return s, lc.fail(ErrNoColumnNameHeader)
 	}
 	columnNames := rows[option.ColumnNameRowIndex]
 	if len(columnNames) == 0 {
-		return s, errors.New("no column")
+		return s, lc.fail(ErrNoColumn)
 	}
 	if option.DataBeginRowIndex < 1 {
-		return s, errors.New("DataBeginRowIndex must >=1")
+		return s, lc.fail(ErrDataBeginRowIndex)
 	}
 	sType := reflect.TypeOf(s)
 	valueType := sType.Elem() // value type of s, 如*pb.ItemCfg or pb.ItemCfg
-	for rowIndex := option.DataBeginRowIndex; rowIndex < len(rows); rowIndex++ {
-		row := rows[rowIndex]
-		value := ConvertCsvLineToValue(valueType, row, columnNames, option)
+	bindings, ok := lc.bindColumns(rowElemType(valueType), option.ColumnNameRowIndex, columnNames)
+	if !ok {
+		return s, lc.errs.Err()
+	}
+	for rowIndex := option.DataBeginRowIndex; rowIndex < len(rows) && !lc.stopped; rowIndex++ {
+		row := lc.normalizeRow(rowIndex, rows[rowIndex], len(columnNames))
+		if row == nil {
+			continue
+		}
+		value := lc.convertRow(valueType, rowIndex, row, bindings)
+		if lc.stopped {
+			break
+		}
 		s = slices.Insert(s, len(s), value.Interface().(V)) // s = append(s, value)
 	}
-	return s, nil
+	return s, lc.errs.Err()
 }
 
 // key-value格式的csv数据转换成对象
 // V支持proto.Message和普通struct结构
+// 单元格的错误不会中断加载,返回的error是LoadErrors
 func ReadCsvFromDataObject[V any](rows [][]string, v V, option *CsvOption) error {
-	if option == nil {
-		option = &DefaultOption
-	}
+	return readCsvFromDataObject(newLoadContext("", option), rows, v)
+}
+
+func readCsvFromDataObject[V any](lc *loadContext, rows [][]string, v V) error {
+	option := lc.option
 	if len(rows) == 0 {
-		return errors.New("no csv header")
+		return lc.fail(ErrNoCsvHeader)
 	}
 	if len(rows[0]) < 2 {
-		return errors.New("column count must >= 2")
+		return lc.fail(ErrObjectColumnCount)
 	}
 	if option.ObjectDataBeginRowIndex < 1 {
-		return errors.New("ObjectDataBeginRowIndex must >=1")
+		return lc.fail(ErrObjectDataBeginRowIndex)
 	}
 	typ := reflect.TypeOf(v) // type of v, 如*pb.ItemCfg or pb.ItemCfg
 	val := reflect.ValueOf(v)
 	if typ.Kind() != reflect.Ptr {
-		return errors.New("v must be Ptr")
+		return lc.fail(ErrObjectNotPtr)
 	}
 	valElem := val.Elem() // *pb.ItemCfg -> pb.ItemCfg
-	// protobuf alias name map
-	var aliasNames map[string]string
+	resolver := newFieldResolver(valElem.Type(), option)
+	// 先检查required的字段
+	boundFields := make(map[string]struct{})
 	for rowIndex := option.ObjectDataBeginRowIndex; rowIndex < len(rows); rowIndex++ {
-		row := rows[rowIndex]
-		// key-value的固定格式,列名不用
-		columnName := row[0]
-		fieldString := row[1]
-		fieldVal := valElem.FieldByName(columnName)
-		if !fieldVal.IsValid() {
-			if aliasNames == nil {
-				aliasNames = getAliasNameMap(valElem.Type(), option)
-			}
-			// xxx.proto里定义的字段名可能是cfg_id
-			// 生成的xxx.pb里面的字段名会变成CfgId
-			// 如果csv里面的列名使用cfg_id也要能解析
-			if realFieldName, ok := aliasNames[columnName]; ok {
-				fieldVal = valElem.FieldByName(realFieldName)
-			}
+		if len(rows[rowIndex]) == 0 {
+			continue
 		}
-		if fieldVal.Kind() == reflect.Ptr { // 指针类型的字段,如 Name *string
-			fieldObj := reflect.New(fieldVal.Type().Elem()) // 如new(string)
-			fieldVal.Set(fieldObj)                          // 如 obj.Name = new(string)
-			fieldVal = fieldObj.Elem()                      // 如 *(obj.Name)
+		if field, ok := resolver.resolve(strings.TrimSpace(rows[rowIndex][0])); ok {
+			boundFields[field.Name] = struct{}{}
 		}
-		ConvertStringToFieldValue(val, fieldVal, columnName, fieldString, option, false)
 	}
-	return nil
+	if !lc.checkRequired(valElem.Type(), -1, boundFields) {
+		return lc.errs.Err()
+	}
+	for rowIndex := option.ObjectDataBeginRowIndex; rowIndex < len(rows) && !lc.stopped; rowIndex++ {
+		// 除了Key和Value列,还可能有注释列
+		row := lc.normalizeRow(rowIndex, rows[rowIndex], len(rows[0]))
+		if row == nil {
+			continue
+		}
+		// key-value的固定格式,列名不用,Value列赋值给Key列对应的字段
+		columnName := strings.TrimSpace(row[0])
+		binding, ok := resolver.binding(1, columnName)
+		if !ok {
+			lc.unknownColumn(rowIndex, 0, columnName, row[0])
+			continue
+		}
+		if binding.tag.Ignore {
+			continue
+		}
+		if !lc.checkSettable(binding, rowIndex, row[1]) {
+			continue
+		}
+		lc.convertCell(val, valElem, binding, rowIndex, row[1], false)
+	}
+	return lc.errs.Err()
 }
@@ -1,10 +1,19 @@
 package csv
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func init() {
@@ -294,6 +303,35 @@ func TestParseNestString(t *testing.T) {
 	for _, pair := range pairs {
 		t.Logf("%v %v", pair.Key, pair.Value)
 	}
+
+	// {}不匹配时返回能解析的部分,E结尾的接口返回带有字符偏移的错误
+	pairs = ParsePairString("a_{x}#b_{", nil)
+	if len(pairs) != 2 || pairs[0].Key != "a" || pairs[1].Key != "b" {
+		t.Fatalf("%v", pairs)
+	}
+	var syntaxErr *SyntaxError
+	_, err := ParsePairStringE("a_{x}#b_{", nil)
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset != 8 {
+		t.Fatalf("%v", err)
+	}
+	_, err = ParseNestStringE("Id_1#Items_{CfgId_1", nil, "Items")
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset != 11 {
+		t.Fatalf("%v", err)
+	}
+	if pairs = ParseNestString("Id_1#Items_{CfgId_1", nil, "Items"); len(pairs) != 2 || pairs[0].Key != "Items" {
+		t.Fatalf("%v", pairs)
+	}
+	_, err = ParseNestStringSliceE("Name_a;Name_b}", nil)
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset != 13 {
+		t.Fatalf("%v", err)
+	}
+	if pairsSlice := ParseNestStringSlice("Name_a;Name_b}", nil); len(pairsSlice) != 2 || pairsSlice[1][0].Value != "b}" {
+		t.Fatalf("%v", pairsSlice)
+	}
+	pairsSlice, err := ParseNestStringSliceE("{Name_a#Items_{CfgId_1}};Name_b", nil)
+	if err != nil || len(pairsSlice) != 2 || pairsSlice[0][1].Value != "CfgId_1" {
+		t.Fatalf("%v %v", pairsSlice, err)
+	}
 }
 
 func TestNestStruct(t *testing.T) {
@@ -345,6 +383,145 @@ func TestNestStruct(t *testing.T) {
 	}
 }
 
+// 嵌套结构不需要注册自定义接口,按字段的类型逐层解析
+func TestNestStructWithoutConverter(t *testing.T) {
+	type Child struct {
+		Name  string
+		Items []*ItemNum // 物品列表
+	}
+	type cfg struct {
+		CfgId    int32
+		Children []*Child // 子对象列表
+	}
+	rows := [][]string{
+		{"CfgId", "Children"},
+		{"1", "Name_a#Items_{CfgId_1#Num_1;CfgId_2#Num_1};Name_b#Items_{CfgId_1#Num_2;CfgId_2#Num_2}"},
+		{"2", "Name_c#Items_{CfgId_3#Num_1;CfgId_4#Num_2}"},
+	}
+	s, err := ReadCsvFromDataSlice(rows, []*cfg(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range s {
+		t.Logf("CfgId:%v", v.CfgId)
+		for i, child := range v.Children {
+			t.Logf("Children[%v].Name:%v", i, child.Name)
+			for j, item := range child.Items {
+				t.Logf("Children[%v].Items[%v]:%v", i, j, item)
+			}
+		}
+	}
+	if len(s) != 2 || len(s[0].Children) != 2 || s[0].Children[1].Name != "b" || *s[0].Children[1].Items[1] != (ItemNum{CfgId: 2, Num: 2}) {
+		t.Fatalf("%v", s)
+	}
+	// 写入的格式和读取的一样
+	writeRows, err := WriteCsvToDataSlice(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(writeRows, rows) {
+		t.Fatalf("%q", writeRows)
+	}
+}
+
+// 元素是基础类型时,{}是普通字符
+func TestBracePlainText(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Tags  []string
+		M     map[string]string
+		Item  struct{ Name string }
+	}
+	rows := [][]string{
+		{"CfgId", "Tags", "M", "Item"},
+		{"1", "smile :-{;ok", "a_{b#c_}", "Name_{x"},
+	}
+	s, err := ReadCsvFromDataSlice(rows, []*cfg(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v", s[0])
+	if !slices.Equal(s[0].Tags, []string{"smile :-{", "ok"}) || !reflect.DeepEqual(s[0].M, map[string]string{"a": "{b", "c": "}"}) || s[0].Item.Name != "{x" {
+		t.Fatalf("%+v", s[0])
+	}
+	// 写入时转义,读取回来一样
+	writeRows, err := WriteCsvToDataSlice(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%q", writeRows)
+	s2, err := ReadCsvFromDataSlice(writeRows, []*cfg(nil), nil)
+	if err != nil || !reflect.DeepEqual(s, s2) {
+		t.Fatalf("%v %+v", err, s2)
+	}
+}
+
+func TestNestStructDepth(t *testing.T) {
+	type Reward struct {
+		Item  ItemNum
+		Items []ItemNum
+	}
+	type Stage struct {
+		Id      int32
+		Rewards map[string]*Reward
+		Args    [][]int32
+	}
+	type cfg struct {
+		CfgId  int32
+		Stages []Stage
+	}
+	rows := [][]string{
+		{"CfgId", "Stages"},
+		{"1", "Id_1#Rewards_{a_{Item_{CfgId_1#Num_2}#Items_{CfgId_2#Num_3;CfgId_3#Num_4}}};Id_2#Args_{{1;2};{3}}"},
+		{"2", "{Id_3#Rewards_{b_{Item_{CfgId_4#Num_5}}}}"},
+	}
+	s, err := ReadCsvFromDataSlice(rows, []*cfg(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []*cfg{
+		{CfgId: 1, Stages: []Stage{
+			{Id: 1, Rewards: map[string]*Reward{"a": {Item: ItemNum{CfgId: 1, Num: 2}, Items: []ItemNum{{CfgId: 2, Num: 3}, {CfgId: 3, Num: 4}}}}},
+			{Id: 2, Args: [][]int32{{1, 2}, {3}}},
+		}},
+		{CfgId: 2, Stages: []Stage{
+			{Id: 3, Rewards: map[string]*Reward{"b": {Item: ItemNum{CfgId: 4, Num: 5}}}},
+		}},
+	}
+	if !reflect.DeepEqual(s, expects) {
+		t.Fatalf("%+v", s)
+	}
+	writeRows, err := WriteCsvToDataSlice(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range writeRows {
+		t.Logf("%q", row)
+	}
+	s2, err := ReadCsvFromDataSlice(writeRows, []*cfg(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s2, expects) {
+		t.Fatalf("%+v", s2)
+	}
+
+	// 语法错误带有字符偏移
+	for cell, offset := range map[string]int{
+		"Id_1#Rewards_{a_{Item_{CfgId_1}}": 13,
+		"Id_1#Rewards_a_1}":                16,
+		"Id_1;{Id_2}#Args_1":               11,
+		"Id_物品#Rewards_{":                  14,
+	} {
+		_, err = ReadCsvFromDataSlice([][]string{{"CfgId", "Stages"}, {"1", cell}}, []*cfg(nil), nil)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) || !errors.Is(err, ErrSyntax) || syntaxErr.Offset != offset {
+			t.Fatalf("%q: %v", cell, err)
+		}
+		t.Logf("%v", err)
+	}
+}
+
 func TestAliasName(t *testing.T) {
 	type s struct {
 		CfgId   int32  `json:"cfgid,omitempty" protobuf:"varint,1,opt,name=cfg_id"`
@@ -365,3 +542,1647 @@ func TestAliasName(t *testing.T) {
 		t.Logf("%v", item)
 	}
 }
+
+func TestLoadError(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Rate  float32
+		Item  ItemNum
+	}
+	rows := [][]string{
+		{"CfgId", "Rate", "Item"},
+		{"1", "0.5", "CfgId_1#Num_2"},
+		{"2", "abc", "CfgId_2#Count_3"},
+	}
+	m := make(map[int32]*cfg)
+	err := ReadCsvFromDataMap(rows, m, nil)
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || len(loadErrs) != 2 {
+		t.Fatalf("expect 2 errors, got %v", err)
+	}
+	t.Logf("%v", err)
+	if e := loadErrs[0]; e.Row != 3 || e.ColumnLetter != "B" || e.ColumnName != "Rate" || e.Value != "abc" || e.FieldPath != "Rate" {
+		t.Fatalf("wrong position: %+v", e)
+	}
+	if e := loadErrs[1]; e.Row != 3 || e.Column != 2 || e.FieldPath != "Item.Count" || !errors.Is(e, ErrUnknownField) {
+		t.Fatalf("wrong position: %+v", e)
+	}
+	// 出错的行也会加载
+	if len(m) != 2 || m[2].Item.CfgId != 2 {
+		t.Fatalf("rows not loaded: %v", m)
+	}
+	if err = ReadCsvFromDataMap(nil, m, nil); !errors.Is(err, ErrNoCsvHeader) {
+		t.Fatalf("expect ErrNoCsvHeader, got %v", err)
+	}
+	if ColumnLetter(0) != "A" || ColumnLetter(25) != "Z" || ColumnLetter(26) != "AA" || ColumnLetter(701) != "ZZ" || ColumnLetter(702) != "AAA" {
+		t.Fatal("ColumnLetter error")
+	}
+}
+
+func TestStrict(t *testing.T) {
+	type cfg struct {
+		CfgId  int32
+		Level  int8
+		Count  uint16
+		Unique bool
+		Nums   []int
+		NumMap map[string]int8
+	}
+	rows := [][]string{
+		{"CfgId", "Level", "Count", "Unique", "Nums", "NumMap", "Unknown"},
+		{"1", "10", "1", "true", "1;2", "a_1", ""},
+		{"2", "300", "-1", "yes", "1;2a", "a_1.5", "x"},
+		{"3a", "", "", "", "", "", ""},
+	}
+	// 默认不是严格模式
+	m := make(map[int32]*cfg)
+	if err := ReadCsvFromDataMap(rows, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if m[2].Level != int8(44) || m[2].Unique || m[0].CfgId != 0 {
+		t.Fatalf("lenient mode changed: %v %v", m[2], m[0])
+	}
+
+	option := DefaultOption
+	option.Strict = true
+	m = make(map[int32]*cfg)
+	err := ReadCsvFromDataMap(rows, m, &option)
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) {
+		t.Fatal(err)
+	}
+	for _, e := range loadErrs {
+		t.Logf("%v", e)
+	}
+	expects := []struct {
+		row       int
+		fieldPath string
+		err       error
+	}{
+		{1, "", ErrUnknownColumn},
+		{3, "Level", strconv.ErrRange},
+		{3, "Count", strconv.ErrSyntax},
+		{3, "Unique", ErrInvalidBool},
+		{3, "Nums[1]", strconv.ErrSyntax},
+		{3, "NumMap[a]", strconv.ErrSyntax},
+		{4, "", strconv.ErrSyntax},
+	}
+	if len(loadErrs) != len(expects) {
+		t.Fatalf("expect %v errors, got %v", len(expects), len(loadErrs))
+	}
+	for i, expect := range expects {
+		e := loadErrs[i]
+		if e.Row != expect.row || e.FieldPath != expect.fieldPath || !errors.Is(e, expect.err) {
+			t.Errorf("errors[%v] expect %v %v %v, got %v", i, expect.row, expect.fieldPath, expect.err, e)
+		}
+	}
+	if len(m) != 2 || m[1].Level != 10 {
+		t.Fatalf("%v", m)
+	}
+}
+
+// 严格模式下空单元格仍然是零值,nonempty和default标签可以改变
+func TestStrictEmpty(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Level int8
+		Count uint16
+		Rate  float32
+		Price *int32
+		Item  struct {
+			Num  int32
+			Rate float64
+		}
+		Num    int32 `csv:",nonempty"`
+		Weight int32 `csv:",default=100"`
+	}
+	rows := [][]string{
+		{"CfgId", "Level", "Count", "Rate", "Price", "Item", "Num", "Weight"},
+		{"1", "", " ", "", "", "Num_#Rate_", "1", ""},
+		{"2", "", "", "", "", "", "", ""},
+	}
+	option := DefaultOption
+	option.Strict = true
+	m := make(map[int32]*cfg)
+	err := ReadCsvFromDataMap(rows, m, &option)
+	t.Logf("%v", err)
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || len(loadErrs) != 1 || loadErrs[0].Row != 3 || !errors.Is(err, ErrEmptyCell) {
+		t.Fatalf("expect only ErrEmptyCell: %v", err)
+	}
+	v := m[1]
+	if v.Level != 0 || v.Count != 0 || v.Rate != 0 || v.Item.Num != 0 || v.Item.Rate != 0 {
+		t.Fatalf("expect zero: %+v", v)
+	}
+	if v.Price == nil || *v.Price != 0 || v.Weight != 100 {
+		t.Fatalf("%+v", v)
+	}
+}
+
+func TestDuplicateKey(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Name  string
+		Price int
+		Items []int
+	}
+	rows := [][]string{
+		{"CfgId", "Name", "Price", "Items"},
+		{"1", "item1", "100", "1;2"},
+		{"2", "item2", "200", ""},
+		{"1", "", "120", "3"},
+	}
+	m := make(map[int32]*cfg)
+	err := ReadCsvFromDataMap(rows, m, nil)
+	var dupErr *DuplicateKeyError
+	if !errors.Is(err, ErrDuplicateKey) || !errors.As(err, &dupErr) || dupErr.FirstRow != 2 {
+		t.Fatalf("expect duplicate key error, got %v", err)
+	}
+	t.Logf("%v", err)
+	if m[1].Price != 100 {
+		t.Fatalf("expect first row, got %v", m[1])
+	}
+
+	option := DefaultOption
+	option.DuplicateKeyPolicy = DuplicateKeyKeepLast
+	m = make(map[int32]*cfg)
+	if err = ReadCsvFromDataMap(rows, m, &option); err != nil {
+		t.Fatal(err)
+	}
+	if m[1].Price != 120 || m[1].Name != "" {
+		t.Fatalf("expect last row, got %v", m[1])
+	}
+
+	option.DuplicateKeyPolicy = DuplicateKeyMerge
+	// 非指针的value
+	m2 := make(map[int32]cfg)
+	if err = ReadCsvFromDataMap(rows, m2, &option); err != nil {
+		t.Fatal(err)
+	}
+	if m2[1].Price != 120 || m2[1].Name != "item1" || !slices.Equal(m2[1].Items, []int{3}) {
+		t.Fatalf("expect merged row, got %v", m2[1])
+	}
+}
+
+func TestRaggedRows(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Name  string
+		Price int
+	}
+	// Excel导出的csv,行尾可能有空单元格
+	data := "CfgId,Name,Price,\n1,item1,100,\n2,item2\n,,,\n\n3,item3,300,,extra\n"
+	file := filepath.Join(t.TempDir(), "ragged.csv")
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[int32]*cfg)
+	if err := ReadCsvFileMap(file, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 3 || m[2].Name != "item2" || m[2].Price != 0 || m[3].Price != 300 {
+		t.Fatalf("%v", m)
+	}
+
+	option := DefaultOption
+	option.RejectRaggedRows = true
+	m = make(map[int32]*cfg)
+	err := ReadCsvFileMap(file, m, &option)
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || len(loadErrs) != 2 || !errors.Is(err, ErrRaggedRow) {
+		t.Fatalf("expect 2 ragged rows, got %v", err)
+	}
+	t.Logf("%v", err)
+	if loadErrs[0].Row != 3 || loadErrs[1].Row != 5 || loadErrs[0].File != file {
+		t.Fatalf("wrong rows: %v", err)
+	}
+	if len(m) != 1 {
+		t.Fatalf("%v", m)
+	}
+
+	// 空行和短行不会导致panic
+	rows := [][]string{
+		{"CfgId", "Name", "Price"},
+		{},
+		{"1"},
+	}
+	s, err := ReadCsvFromDataSlice(rows, []cfg(nil), nil)
+	if err != nil || len(s) != 1 {
+		t.Fatalf("%v %v", s, err)
+	}
+}
+
+func TestConverterE(t *testing.T) {
+	type cfg struct {
+		CfgId  int32
+		Color  Color
+		Colors []Color
+		Item   *ItemNum
+		Flags  int32
+	}
+	rows := [][]string{
+		{"CfgId", "Color", "Colors", "Item", "Flags"},
+		{"1", "Red", "Red;Green", "1_2", "Red"},
+		{"2", "Pink", "Blue;Pink", "", ""},
+		{"3", "", "", "3", "Gray"},
+	}
+	option := DefaultOption
+	option.RegisterConverterEByType(reflect.TypeOf(Color(0)), func(ctx ConvertContext) (any, error) {
+		if ctx.FieldString == "" {
+			return nil, nil
+		}
+		if colorValue, ok := Color_value["Color_"+ctx.FieldString]; ok {
+			return Color(colorValue), nil
+		}
+		return nil, fmt.Errorf("unknown color %v", ctx.FieldString)
+	})
+	// 返回值类型错误
+	option.RegisterConverterEByType(reflect.TypeOf(&ItemNum{}), func(ctx ConvertContext) (any, error) {
+		if ctx.FieldString == "" {
+			return nil, nil
+		}
+		strs := strings.Split(ctx.FieldString, "_")
+		if len(strs) != 2 {
+			return ItemNum{}, nil
+		}
+		return &ItemNum{CfgId: int32(Atoi(strs[0])), Num: int32(Atoi(strs[1]))}, nil
+	})
+	// 列名注册的FieldConverter返回nil,不会panic
+	option.RegisterConverterByColumnName("Flags", func(obj any, columnName, fieldStr string) any {
+		if fieldStr == "Red" {
+			return int32(1)
+		}
+		return nil
+	})
+	m := make(map[int32]*cfg)
+	err := ReadCsvFromDataMap(rows, m, &option)
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || len(loadErrs) != 3 {
+		t.Fatalf("expect 3 errors, got %v", err)
+	}
+	t.Logf("%v", err)
+	if e := loadErrs[0]; e.Row != 3 || e.ColumnName != "Color" || e.Value != "Pink" {
+		t.Fatalf("%v", e)
+	}
+	if e := loadErrs[1]; e.Row != 3 || e.FieldPath != "Colors[1]" {
+		t.Fatalf("%v", e)
+	}
+	if e := loadErrs[2]; e.Row != 4 || e.FieldPath != "Item" || !errors.Is(e, ErrConvertedType) {
+		t.Fatalf("%v", e)
+	}
+	if m[1].Color != Color_Color_Red || len(m[2].Colors) != 1 || m[1].Item.Num != 2 || m[1].Flags != 1 {
+		t.Fatalf("%v %v", m[1], m[2])
+	}
+}
+
+func TestRequiredColumn(t *testing.T) {
+	type cfg struct {
+		CfgId int32  `csv:",required"`
+		Name  string `csv:"item_name,required,nonempty"`
+		Price int    `csv:"Price,required"`
+	}
+	rows := [][]string{
+		{"CfgId", "item_name"},
+		{"1", "item1"},
+	}
+	m := make(map[int32]*cfg)
+	err := ReadCsvFromDataMap(rows, m, nil)
+	var loadErr *LoadError
+	if !errors.Is(err, ErrMissingColumn) || !errors.As(err, &loadErr) || loadErr.ColumnName != "Price" || loadErr.Row != 1 {
+		t.Fatalf("expect missing column, got %v", err)
+	}
+	t.Logf("%v", err)
+	// 表头错误时不解析数据行
+	if len(m) != 0 {
+		t.Fatalf("%v", m)
+	}
+
+	rows = [][]string{
+		{"CfgId", "item_name", "Price"},
+		{"1", "item1", "10"},
+		{"2", " ", "20"},
+	}
+	err = ReadCsvFromDataMap(rows, m, nil)
+	if !errors.Is(err, ErrEmptyCell) || !errors.As(err, &loadErr) || loadErr.Row != 3 || loadErr.FieldPath != "Name" {
+		t.Fatalf("expect empty cell, got %v", err)
+	}
+	t.Logf("%v", err)
+
+	type settings struct {
+		Volume   int `csv:",required"`
+		Language string
+	}
+	objRows := [][]string{
+		{"Key", "Value", "comment"},
+		{"Language", "English", "语言设置"},
+	}
+	if err = ReadCsvFromDataObject(objRows, new(settings), nil); !errors.Is(err, ErrMissingColumn) {
+		t.Fatalf("expect missing column, got %v", err)
+	}
+}
+
+func TestSplitTagOptions(t *testing.T) {
+	// default的value为空时,不会把后面的逗号作为value
+	name, options := splitTagOptions("name,required,default=,nonempty")
+	expects := []tagOption{{"required", ""}, {"default", ""}, {"nonempty", ""}}
+	if name != "name" || !slices.Equal(options, expects) {
+		t.Fatalf("%v %v", name, options)
+	}
+	name, options = splitTagOptions("-")
+	if name != "-" || len(options) != 0 {
+		t.Fatalf("%v %v", name, options)
+	}
+	// 分隔符的选项可以是逗号,其他选项的value为空
+	name, options = splitTagOptions(",sep=,,default=,kv=:,pair=,")
+	expects = []tagOption{{"sep", ","}, {"default", ""}, {"kv", ":"}, {"pair", ","}}
+	if name != "" || !slices.Equal(options, expects) {
+		t.Fatalf("%v %v", name, options)
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Price int     `csv:",default=100"`
+		Nums  []int   `csv:",default=1;2"`
+		Item  ItemNum `csv:",default=CfgId_1#Num_2"`
+		Count *int32  `csv:",default=5"`
+		Color Color   // 类型注册的默认值,通过注册的转换接口解析
+		Rate  float32 // 列名注册的默认值
+		Tags  []string
+	}
+	rows := [][]string{
+		{"CfgId", "Price", "Nums", "Item", "Count", "Color", "Rate", "Tags"},
+		{"1", "", "", "", "", "", "", ""},
+		{"2", "200", "3", "CfgId_3#Num_4", "6", "Blue", "0.5", "a"},
+	}
+	option := DefaultOption
+	option.RegisterConverterByType(reflect.TypeOf(Color(0)), func(obj any, columnName, fieldStr string) any {
+		return Color(Color_value["Color_"+fieldStr])
+	})
+	option.RegisterDefaultByType(reflect.TypeOf(Color(0)), "Red")
+	option.RegisterDefaultByColumnName("Rate", "1.5")
+	m := make(map[int32]*cfg)
+	if err := ReadCsvFromDataMap(rows, m, &option); err != nil {
+		t.Fatal(err)
+	}
+	c := m[1]
+	if c.Price != 100 || !slices.Equal(c.Nums, []int{1, 2}) || c.Item.Num != 2 || *c.Count != 5 || c.Color != Color_Color_Red || c.Rate != 1.5 || c.Tags != nil {
+		t.Fatalf("%+v", c)
+	}
+	c = m[2]
+	if c.Price != 200 || !slices.Equal(c.Nums, []int{3}) || c.Item.Num != 4 || *c.Count != 6 || c.Color != Color_Color_Blue || c.Rate != 0.5 {
+		t.Fatalf("%+v", c)
+	}
+}
+
+func TestConverterPanic(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Color Color
+		Name  string
+	}
+	rows := [][]string{
+		{"CfgId", "Color", "Name"},
+		{"1", "Red", "a"},
+		{"2", "Bug", "b"},
+		{"3", "Blue", "c"},
+	}
+	option := DefaultOption
+	option.RegisterConverterByType(reflect.TypeOf(Color(0)), func(obj any, columnName, fieldStr string) any {
+		if fieldStr == "Bug" {
+			var m map[string]int
+			m["panic"] = 1
+		}
+		return Color(Color_value["Color_"+fieldStr])
+	})
+	m := make(map[int32]*cfg)
+	err := ReadCsvFromDataMap(rows, m, &option)
+	var loadErr *LoadError
+	var panicErr *PanicError
+	if !errors.Is(err, ErrPanic) || !errors.As(err, &loadErr) || !errors.As(err, &panicErr) {
+		t.Fatalf("expect panic error, got %v", err)
+	}
+	t.Logf("%v", err)
+	if loadErr.Row != 3 || loadErr.ColumnName != "Color" || loadErr.Value != "Bug" || len(panicErr.Stack) == 0 {
+		t.Fatalf("%+v", loadErr)
+	}
+	// panic之后继续加载
+	if len(m) != 3 || m[2].Name != "b" || m[3].Color != Color_Color_Blue {
+		t.Fatalf("%v", m)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Name  string
+		price int
+	}
+	rows := [][]string{
+		{"CfgId", "Name", "price", "Unknown"},
+		{"1", "item1", "10", ""},
+		{"2", "item2"},
+		{"3", "abc", "", "", "extra"},
+	}
+	collector := &DiagnosticsCollector{}
+	option := DefaultOption
+	option.Diagnostics = collector
+	m := make(map[int32]*cfg)
+	if err := ReadCsvFromDataMap(rows, m, &option); err != nil {
+		t.Fatal(err)
+	}
+	warnings := collector.Diagnostics(SeverityWarning)
+	for _, d := range warnings {
+		t.Logf("%v", d)
+	}
+	if len(warnings) != 4 || len(collector.Diagnostics(SeverityError)) != 0 {
+		t.Fatalf("expect 4 warnings, got %v", collector.Diagnostics(-1))
+	}
+	if d := warnings[0]; !errors.Is(d.Err, ErrFieldCantSet) || d.ColumnLetter != "C" || d.FieldPath != "price" {
+		t.Fatalf("%v", d)
+	}
+	if d := warnings[1]; !errors.Is(d.Err, ErrUnknownColumn) || d.Row != 1 || d.ColumnName != "Unknown" {
+		t.Fatalf("%v", d)
+	}
+	if d := warnings[2]; !errors.Is(d.Err, ErrRaggedRow) || d.Row != 3 {
+		t.Fatalf("%v", d)
+	}
+
+	// 错误也会输出到Diagnostics
+	collector.Reset()
+	option.Strict = true
+	err := ReadCsvFromDataMap(rows, m, &option)
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || len(loadErrs) != len(collector.Diagnostics(SeverityError)) {
+		t.Fatalf("%v %v", err, collector.Diagnostics(-1))
+	}
+
+	// 输出到指定的slog.Logger
+	var buf bytes.Buffer
+	option.Strict = false
+	option.Diagnostics = NewSlogDiagnostics(slog.New(slog.NewTextHandler(&buf, nil)))
+	if err = ReadCsvFromDataMap(rows, m, &option); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `level=WARN msg="unknown column" row=1 column=D`) {
+		t.Fatalf("%v", buf.String())
+	}
+
+	// 不输出
+	option.Diagnostics = NopDiagnostics
+	if err = ReadCsvFromDataMap(rows, m, &option); err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认只把警告输出到slog.Default(),错误已经作为error返回
+	buf.Reset()
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
+	option.Diagnostics = nil
+	option.Strict = true
+	if err = ReadCsvFromDataMap(rows, m, &option); err == nil {
+		t.Fatal("expect error")
+	}
+	t.Logf("%v", buf.String())
+	if !strings.Contains(buf.String(), "level=WARN") || strings.Contains(buf.String(), "level=ERROR") {
+		t.Fatalf("%v", buf.String())
+	}
+}
+
+func TestErrorPolicy(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Rate  float32
+		Speed float32
+	}
+	rows := [][]string{
+		{"CfgId", "Rate", "Speed"},
+		{"1", "0.5", "1"},
+		{"2", "a", "b"},
+		{"3", "c", "1"},
+		{"4", "0.1", "d"},
+		{"5", "0.2", "2"},
+	}
+	option := DefaultOption
+	option.Diagnostics = NopDiagnostics
+	// 默认收集所有错误,并返回解析的数据
+	m := make(map[int32]*cfg)
+	err := ReadCsvFromDataMap(rows, m, &option)
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || len(loadErrs) != 4 || len(m) != 5 {
+		t.Fatalf("%v %v", err, m)
+	}
+
+	option.ErrorPolicy = ErrorPolicyStopOnFirst
+	m = make(map[int32]*cfg)
+	err = ReadCsvFromDataMap(rows, m, &option)
+	if !errors.As(err, &loadErrs) || len(loadErrs) != 1 || len(m) != 1 {
+		t.Fatalf("%v %v", err, m)
+	}
+
+	option.ErrorPolicy = ErrorPolicyMaxErrors
+	option.MaxErrors = 3
+	s, err := ReadCsvFromDataSlice(rows, []*cfg(nil), &option)
+	if !errors.As(err, &loadErrs) || len(loadErrs) != 4 || !errors.Is(loadErrs[3], ErrTooManyErrors) || len(s) != 2 {
+		t.Fatalf("%v %v", err, s)
+	}
+	t.Logf("%v", err)
+}
+
+func TestWriteCsv(t *testing.T) {
+	type cfg struct {
+		CfgId  int32   `protobuf:"varint,1,opt,name=cfg_id"`
+		Name   string  `json:"name"`
+		Rate   float32 `csv:"rate"`
+		Unique bool
+		Count  *int32
+		Remark string
+	}
+	count := int32(5)
+	m := map[int32]*cfg{
+		3: {CfgId: 3, Name: "装备3", Rate: 0.25, Unique: true, Count: &count, Remark: "test"},
+		1: {CfgId: 1, Name: "普通物品1", Rate: 1.5},
+		2: {CfgId: 2, Name: "普通物品2", Count: new(int32)},
+	}
+	// 表头和数据之间有一行注释
+	option := CsvOption{
+		ColumnNameRowIndex: 0,
+		DataBeginRowIndex:  2,
+		SliceSeparator:     ";",
+		KvSeparator:        "_",
+		PairSeparator:      "#",
+	}
+	option.IgnoreColumn("Remark")
+	rows, err := WriteCsvToDataMap(m, &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		t.Logf("%v", row)
+	}
+	// 写入时使用字段名,protobuf和json的字段别名只用于读取
+	if !slices.Equal(rows[0], []string{"CfgId", "Name", "rate", "Unique", "Count"}) ||
+		!slices.Equal(rows[2], []string{"1", "普通物品1", "1.5", "", ""}) ||
+		!slices.Equal(rows[3], []string{"2", "普通物品2", "", "", ""}) ||
+		!slices.Equal(rows[4], []string{"3", "装备3", "0.25", "true", "5"}) {
+		t.Fatalf("%v", rows)
+	}
+
+	file := filepath.Join(t.TempDir(), "cfg.csv")
+	if err = WriteCsvFileMap(file, m, &option); err != nil {
+		t.Fatal(err)
+	}
+	readMap := make(map[int32]*cfg)
+	if err = ReadCsvFileMap(file, readMap, &option); err != nil {
+		t.Fatal(err)
+	}
+	// 空单元格读取时会给指针字段分配零值
+	m[1].Count = new(int32)
+	for k, v := range m {
+		v.Remark = ""
+		if !reflect.DeepEqual(v, readMap[k]) {
+			t.Fatalf("%v %v", v, readMap[k])
+		}
+	}
+
+	s := []cfg{{CfgId: 2, Name: "b", Count: &count}, {CfgId: 1, Name: "a", Count: &count}}
+	if err = WriteCsvFileSlice(file, s, &option); err != nil {
+		t.Fatal(err)
+	}
+	readSlice, err := ReadCsvFileSlice(file, []cfg(nil), &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, readSlice) {
+		t.Fatalf("%v %v", s, readSlice)
+	}
+
+	// 第一列不是key对应的字段时,读取回来的key会不一样
+	type noKeyCfg struct {
+		Name  string
+		Price int32
+	}
+	_, err = WriteCsvToDataMap(map[int32]*noKeyCfg{7: {Name: "sword", Price: 100}}, &DefaultOption)
+	t.Logf("%v", err)
+	if !errors.Is(err, ErrKeyColumn) {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestConvertFieldValueToString(t *testing.T) {
+	type cfg struct {
+		Item   ItemNum
+		Items  []*ItemNum
+		Args   CfgArgs
+		Nums   []int32
+		Names  []string
+		Attrs  map[string]int
+		Rate   *float64
+		Flag   bool
+		Price  int `csv:",default=100"`
+		Remark string
+	}
+	rate := 0.5
+	src := &cfg{
+		Item:  ItemNum{CfgId: 1, Num: 2},
+		Items: []*ItemNum{{CfgId: 1, Num: 2}, {CfgId: 2}, {}},
+		Args:  CfgArgs{CfgId: 3, Args: []int32{1, 2, 3}},
+		Nums:  []int32{0, -1, 2},
+		Names: []string{"a", "b"},
+		Attrs: map[string]int{"hp": 100, "atk": 0},
+		Rate:  &rate,
+		Flag:  true,
+	}
+	expects := map[string]string{
+		"Item":   "CfgId_1#Num_2",
+		"Items":  "CfgId_1#Num_2;CfgId_2;CfgId_0",
+		"Args":   "CfgId_3#Args_1;2;3",
+		"Nums":   "0;-1;2",
+		"Names":  "a;b",
+		"Attrs":  "atk_0#hp_100",
+		"Rate":   "0.5",
+		"Flag":   "true",
+		"Price":  "",
+		"Remark": "",
+	}
+	srcVal := reflect.ValueOf(src).Elem()
+	row := make([]string, 0, len(expects))
+	columnNames := make([]string, 0, len(expects))
+	for i := 0; i < srcVal.NumField(); i++ {
+		columnName := srcVal.Type().Field(i).Name
+		s, err := ConvertFieldValueToString(srcVal.Field(i), columnName, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%v: %v", columnName, s)
+		if s != expects[columnName] {
+			t.Fatalf("%v: %v %v", columnName, s, expects[columnName])
+		}
+		row = append(row, s)
+		columnNames = append(columnNames, columnName)
+	}
+	// 读取回来和原始数据一致
+	src.Price = 100
+	dst, err := ConvertCsvLineToValueE(reflect.TypeOf(src), row, columnNames, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(src, dst.Interface()) {
+		t.Fatalf("%v %v", src, dst.Interface())
+	}
+	if dst = ConvertCsvLineToValue(reflect.TypeOf(src), row, columnNames, nil); !reflect.DeepEqual(src, dst.Interface()) {
+		t.Fatalf("%v %v", src, dst.Interface())
+	}
+	// 单元格的错误
+	var loadErrs LoadErrors
+	strictOption := DefaultOption
+	strictOption.Strict = true
+	if _, err = ConvertCsvLineToValueE(reflect.TypeOf(src), []string{"abc"}, []string{"Price"}, &strictOption); !errors.As(err, &loadErrs) || loadErrs[0].ColumnName != "Price" {
+		t.Fatalf("%v", err)
+	}
+
+	// 值里的分隔符加上转义字符
+	src.Names = []string{"a;b", `C:\dir\`}
+	src.Attrs = map[string]int{"a_b": 1}
+	escapeExpects := map[string]string{
+		"Names": `a\;b;C:\\dir\\`,
+		"Attrs": `a\_b_1`,
+	}
+	for columnName, expect := range escapeExpects {
+		s, err := ConvertFieldValueToString(srcVal.FieldByName(columnName), columnName, nil)
+		if err != nil || s != expect {
+			t.Fatalf("%v: %v %v", columnName, s, err)
+		}
+		t.Logf("%v: %v", columnName, s)
+		dst := reflect.New(srcVal.Type())
+		if err = ConvertStringToFieldValue(dst, dst.Elem().FieldByName(columnName), columnName, s, &DefaultOption, false); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(dst.Elem().FieldByName(columnName).Interface(), srcVal.FieldByName(columnName).Interface()) {
+			t.Fatalf("%v: %v", columnName, dst.Elem().FieldByName(columnName).Interface())
+		}
+	}
+	type named struct {
+		Name string
+	}
+	nameds := []named{{Name: "Fire_Sword#{1}"}, {Name: "a;b"}}
+	s, err := ConvertFieldValueToString(reflect.ValueOf(nameds), "", nil)
+	if err != nil || s != `Name_Fire_Sword\#\{1\};{Name_a;b}` {
+		t.Fatalf("%v %v", s, err)
+	}
+	var readNameds []named
+	if err = ConvertStringToFieldValue(reflect.ValueOf(&readNameds), reflect.ValueOf(&readNameds).Elem(), "", s, &DefaultOption, false); err != nil || !reflect.DeepEqual(readNameds, nameds) {
+		t.Fatalf("%v %v", readNameds, err)
+	}
+	// 转义字符后面不是特殊字符时保持原样
+	if s := UnescapeString(`C:\dir\;`, nil); s != `C:\dir;` {
+		t.Fatal(s)
+	}
+	// 不转义时,分隔符冲突
+	noEscapeOption := DefaultOption
+	noEscapeOption.EscapeChar = ""
+	_, err = ConvertFieldValueToString(srcVal.FieldByName("Names"), "Names", &noEscapeOption)
+	if !errors.Is(err, ErrSeparatorInValue) {
+		t.Fatal(err)
+	}
+	_, err = ConvertFieldValueToString(srcVal.FieldByName("Attrs"), "Attrs", &noEscapeOption)
+	if !errors.Is(err, ErrSeparatorInValue) {
+		t.Fatal(err)
+	}
+	_, err = ConvertFieldValueToString(reflect.ValueOf([]string{"a", "", "c"}), "", nil)
+	if !errors.As(err, &loadErrs) || loadErrs[0].FieldPath != "[1]" || !errors.Is(err, ErrSliceElem) {
+		t.Fatal(err)
+	}
+	t.Logf("%v", err)
+}
+
+func TestFormatter(t *testing.T) {
+	type colorCfg struct {
+		CfgId      int32
+		Color      Color
+		ColorPtr   *Color
+		Colors     []Color
+		ColorFlags int32 // 颜色的组合值,如 Red | Green
+		Items      []ItemNum
+	}
+	option := DefaultOption
+	collector := &DiagnosticsCollector{}
+	option.Diagnostics = collector
+	option.RegisterConverterByType(reflect.TypeOf(Color(0)), func(obj any, columnName, fieldStr string) any {
+		if colorValue, ok := Color_value["Color_"+fieldStr]; ok {
+			return Color(colorValue)
+		}
+		return Color(0)
+	})
+	option.RegisterConverterByColumnName("ColorFlags", func(obj any, columnName, fieldStr string) any {
+		flags := int32(0)
+		for _, colorStr := range strings.Split(fieldStr, ";") {
+			if colorValue, ok := Color_value["Color_"+colorStr]; ok && colorValue > 0 {
+				flags |= 1 << (colorValue - 1)
+			}
+		}
+		return flags
+	})
+	option.RegisterConverterByType(reflect.TypeOf(&ItemNum{}), func(obj any, columnName, fieldStr string) any {
+		strs := strings.Split(fieldStr, "_")
+		if len(strs) != 2 {
+			return nil
+		}
+		return &ItemNum{CfgId: int32(Atoi(strs[0])), Num: int32(Atoi(strs[1]))}
+	})
+	s := []*colorCfg{
+		{CfgId: 1, Color: Color_Color_Red, Colors: []Color{Color_Color_Red, Color_Color_Blue}, ColorFlags: 1 | 4, Items: []ItemNum{{CfgId: 1, Num: 2}}},
+		{CfgId: 2, Color: Color_Color_Gray, ColorFlags: 16},
+	}
+	s[0].ColorPtr = &s[0].Color
+
+	// 没有注册格式化接口
+	if _, err := WriteCsvToDataSlice(s, &option); err != nil {
+		t.Fatal(err)
+	}
+	warnings := collector.Diagnostics(SeverityWarning)
+	if len(warnings) != 5 || !errors.Is(warnings[0].Err, ErrNoFormatter) || warnings[0].ColumnName != "Color" {
+		t.Fatalf("%v", warnings)
+	}
+	for _, d := range warnings {
+		t.Logf("%v", d)
+	}
+
+	option.RegisterFormatterByType(reflect.TypeOf(Color(0)), func(ctx FormatContext) (string, error) {
+		color := ctx.FieldValue.(Color)
+		name, ok := Color_name[int32(color)]
+		if !ok {
+			return "", fmt.Errorf("unknown color %v", color)
+		}
+		return strings.TrimPrefix(name, "Color_"), nil
+	})
+	option.RegisterFormatterByColumnName("ColorFlags", func(ctx FormatContext) (string, error) {
+		flags := ctx.FieldValue.(int32)
+		var colorStrs []string
+		for colorValue := int32(1); colorValue <= 5; colorValue++ {
+			if flags&(1<<(colorValue-1)) != 0 {
+				colorStrs = append(colorStrs, strings.TrimPrefix(Color_name[colorValue], "Color_"))
+			}
+		}
+		return strings.Join(colorStrs, ";"), nil
+	})
+	// 注册的是指针类型,ItemNum也会使用
+	option.RegisterFormatterByType(reflect.TypeOf(&ItemNum{}), func(ctx FormatContext) (string, error) {
+		item := ctx.FieldValue.(*ItemNum)
+		return fmt.Sprintf("%v_%v", item.CfgId, item.Num), nil
+	})
+	collector.Reset()
+	rows, err := WriteCsvToDataSlice(s, &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collector.Diagnostics(SeverityWarning)) != 0 {
+		t.Fatalf("%v", collector.Diagnostics(-1))
+	}
+	for _, row := range rows {
+		t.Logf("%v", row)
+	}
+	if !slices.Equal(rows[1], []string{"1", "Red", "Red", "Red;Blue", "Red;Blue", "1_2"}) {
+		t.Fatalf("%v", rows[1])
+	}
+	readSlice, err := ReadCsvFromDataSlice(rows, []*colorCfg(nil), &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空单元格读取时会给指针字段分配零值
+	s[1].ColorPtr = new(Color)
+	if !reflect.DeepEqual(s, readSlice) {
+		t.Fatalf("%v %v", s, readSlice)
+	}
+
+	// 格式化接口的错误带有单元格的位置
+	s[1].Color = Color(100)
+	_, err = WriteCsvToDataSlice(s, &option)
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || loadErrs[0].Row != 3 || loadErrs[0].ColumnLetter != "B" {
+		t.Fatal(err)
+	}
+	t.Logf("%v", err)
+}
+
+func TestWriteCsvFromObject(t *testing.T) {
+	type Settings struct {
+		ImageQuality int    `csv:",comment=画质设置"`
+		Volume       int    `json:"volume"`
+		Language     string `csv:",comment=语言设置"`
+		FullScreen   bool   `csv:",comment=全屏"`
+	}
+	settings := &Settings{ImageQuality: 80, Volume: 50, Language: "English", FullScreen: true}
+	rows, err := WriteCsvFromObject(nil, settings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		t.Logf("%v", row)
+	}
+	if !slices.Equal(rows[2], []string{"Volume", "50", ""}) || !slices.Equal(rows[3], []string{"Language", "English", "语言设置"}) {
+		t.Fatalf("%v", rows)
+	}
+
+	// 合并已有的数据,保留行的顺序和注释
+	existRows := [][]string{
+		{"Key", "Value", "comment"},
+		{"Language", "Simplified Chinese", "语言"},
+		{"Volume", "80", "音量设置"},
+		{"ImageQuality", "100", ""},
+	}
+	file := filepath.Join(t.TempDir(), "settings.csv")
+	if err = WriteCsvFile(file, existRows); err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteCsvFileObject(file, settings, nil); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = ReadCsvFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		t.Logf("%v", row)
+	}
+	expects := [][]string{
+		{"Key", "Value", "comment"},
+		{"Language", "English", "语言"},
+		{"Volume", "50", "音量设置"},
+		{"ImageQuality", "80", "画质设置"},
+		{"FullScreen", "true", "全屏"},
+	}
+	if !reflect.DeepEqual(rows, expects) || existRows[1][1] != "Simplified Chinese" {
+		t.Fatalf("%v", rows)
+	}
+	readSettings := new(Settings)
+	if err = ReadCsvFileObject(file, readSettings, nil); err != nil {
+		t.Fatal(err)
+	}
+	if *readSettings != *settings {
+		t.Fatalf("%v %v", readSettings, settings)
+	}
+}
+
+// 不包含分隔符和大括号的字符串,才能正确的解析
+func isPlainString(option *CsvOption, strs ...string) bool {
+	for _, s := range strs {
+		if strings.ContainsAny(s, option.SliceSeparator+option.KvSeparator+option.PairSeparator+option.EscapeChar+"{}") {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzParsePairString(f *testing.F) {
+	f.Add("CfgId", "1", "Num", "2")
+	f.Add("a", "", "", "b")
+	f.Fuzz(func(t *testing.T, k1, v1, k2, v2 string) {
+		option := &DefaultOption
+		// 任意的字符串都不能panic
+		ParsePairString(k1+v1+k2+v2, option)
+		if !isPlainString(option, k1, v1, k2, v2) {
+			t.Skip()
+		}
+		s := k1 + option.KvSeparator + v1 + option.PairSeparator + k2 + option.KvSeparator + v2
+		pairs := ParsePairString(s, option)
+		if len(pairs) != 2 || *pairs[0] != (StringPair{k1, v1}) || *pairs[1] != (StringPair{k2, v2}) {
+			t.Fatalf("%q: %v", s, pairs)
+		}
+	})
+}
+
+func FuzzParseNestString(f *testing.F) {
+	f.Add("1", "2", "3", "4")
+	f.Add("", "", "", "")
+	f.Fuzz(func(t *testing.T, id, cfgId, num, count string) {
+		option := &DefaultOption
+		ParseNestString(id+cfgId+num+count, option, "Items")
+		if !isPlainString(option, id, cfgId, num, count) {
+			t.Skip()
+		}
+		// CfgId_1#Items_{CfgId_2#Num_3}#Count_4
+		items := fmt.Sprintf("CfgId_%v#Num_%v", cfgId, num)
+		s := fmt.Sprintf("CfgId_%v#Items_{%v}#Count_%v", id, items, count)
+		pairs := ParseNestString(s, option, "Items")
+		expects := []StringPair{{"Items", items}, {"CfgId", id}, {"Count", count}}
+		if len(pairs) != len(expects) {
+			t.Fatalf("%q: %v", s, pairs)
+		}
+		for i, pair := range pairs {
+			if *pair != expects[i] {
+				t.Fatalf("%q: %v", s, pairs)
+			}
+		}
+	})
+}
+
+func FuzzParseNestStringSlice(f *testing.F) {
+	f.Add("a", "1", "b", "2")
+	f.Add("Items", "1", "Items", "1")
+	f.Fuzz(func(t *testing.T, name1, num1, name2, num2 string) {
+		option := &DefaultOption
+		ParseNestStringSlice(name1+num1+name2+num2, option, "Items")
+		if !isPlainString(option, name1, num1, name2, num2) {
+			t.Skip()
+		}
+		// Name_a#Items_{CfgId_1#Num_1;CfgId_2#Num_1};Name_b#Items_{CfgId_1#Num_2}
+		items1 := fmt.Sprintf("CfgId_1#Num_%v;CfgId_2#Num_%v", num1, num1)
+		items2 := fmt.Sprintf("CfgId_1#Num_%v", num2)
+		s := fmt.Sprintf("Name_%v#Items_{%v};Name_%v#Items_{%v}", name1, items1, name2, items2)
+		pairsSlice := ParseNestStringSlice(s, option, "Items")
+		expects := [][]StringPair{
+			{{"Name", name1}, {"Items", items1}},
+			{{"Name", name2}, {"Items", items2}},
+		}
+		if len(pairsSlice) != len(expects) {
+			t.Fatalf("%q: %v", s, pairsSlice)
+		}
+		for i, pairs := range pairsSlice {
+			if len(pairs) != len(expects[i]) {
+				t.Fatalf("%q: %v", s, pairsSlice)
+			}
+			for j, pair := range pairs {
+				if *pair != expects[i][j] {
+					t.Fatalf("%q: %v", s, pairsSlice)
+				}
+			}
+		}
+	})
+}
+
+func FuzzEscapeString(f *testing.F) {
+	f.Add("a;b", "c_d#e")
+	f.Add(`{f}\`, `C:\dir`)
+	f.Fuzz(func(t *testing.T, s1, s2 string) {
+		if s1 == "" || s2 == "" || !utf8.ValidString(s1+s2) {
+			t.Skip()
+		}
+		// 任意的字符串转义后都可以解析回来
+		type named struct {
+			Name  string
+			Names []string
+		}
+		src := map[string]named{s1: {Name: s2, Names: []string{s1, s2}}}
+		s, err := ConvertFieldValueToString(reflect.ValueOf(src), "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dst map[string]named
+		if err = ConvertStringToFieldValue(reflect.ValueOf(&dst), reflect.ValueOf(&dst).Elem(), "", s, &DefaultOption, false); err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		if !reflect.DeepEqual(src, dst) {
+			t.Fatalf("%q: %v", s, dst)
+		}
+	})
+}
+
+func TestGenerateCsvTemplate(t *testing.T) {
+	type cfg struct {
+		CfgId int32      `json:"CfgId,omitempty" protobuf:"varint,1,opt,name=cfg_id" csv:",comment=配置id"`
+		Name  string     `json:"name,omitempty" csv:",comment=物品名"`
+		Items []*ItemNum `csv:"items"`
+		Attrs map[string]int32
+		inner int
+	}
+	option := DefaultOption
+	option.DataBeginRowIndex = 4
+	rows, err := GenerateCsvTemplate(reflect.TypeOf(&cfg{}), &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		t.Logf("%q", row)
+	}
+	expects := [][]string{
+		{"CfgId", "Name", "items", "Attrs"},
+		{"int32", "string", "[]*csv.ItemNum", "map[string]int32"},
+		{"配置id", "物品名", "", ""},
+		{"cfg_id", "name", "", ""},
+	}
+	if !reflect.DeepEqual(rows, expects) {
+		t.Fatalf("%q", rows)
+	}
+	// 模板可以被读取,表头和数据行之间的信息不会被解析
+	rows = append(rows, []string{"1", "a", "CfgId_1#Num_2", "hp_100"})
+	s, err := ReadCsvFromDataSlice(rows, []*cfg(nil), &option)
+	if err != nil || len(s) != 1 || s[0].Items[0].Num != 2 {
+		t.Fatalf("%v %v", err, s)
+	}
+}
+
+func TestCanonicalizeTable(t *testing.T) {
+	type cfg struct {
+		CfgId  int32
+		Name   string
+		Unique bool
+		Rate   float32
+		Nums   []int
+		Color  Color
+	}
+	rows := [][]string{
+		{" CfgId", "Rate ", "Name", "Color", "comment", "Unique", "Nums", ""},
+		{"10", "1.50", " 装备10 ", "Red", "注释", "1", "1; 2", ""},
+		{"", "", "", "", "", "", "", ""},
+		{"+2", "0", "普通物品2", "", "", "0", "", ""},
+		{"1", "abc", "普通物品1", "", "", "TRUE", "007", ""},
+	}
+	option := DefaultOption
+	collector := &DiagnosticsCollector{}
+	option.Diagnostics = collector
+	option.RegisterConverterByType(reflect.TypeOf(Color(0)), func(obj any, columnName, fieldStr string) any {
+		return Color(Color_value["Color_"+fieldStr])
+	})
+	newRows, err := CanonicalizeTable(rows, reflect.TypeOf(&cfg{}), &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range newRows {
+		t.Logf("%q", row)
+	}
+	expects := [][]string{
+		{"CfgId", "Name", "Unique", "Rate", "Nums", "Color", "comment"},
+		{"1", "普通物品1", "true", "abc", "7", "", ""},
+		{"2", "普通物品2", "false", "0", "", "", ""},
+		{"10", "装备10", "true", "1.5", "1; 2", "Red", "注释"},
+	}
+	if !reflect.DeepEqual(newRows, expects) {
+		t.Fatalf("%q", newRows)
+	}
+	// 无法规范化的单元格保持原样,并输出警告
+	warnings := collector.Diagnostics(SeverityWarning)
+	for _, d := range warnings {
+		t.Logf("%v", d)
+	}
+	if len(warnings) != 4 {
+		t.Fatalf("%v", warnings)
+	}
+	// 规范化之后不再变化
+	again, err := CanonicalizeTable(newRows, reflect.TypeOf(&cfg{}), &option)
+	if err != nil || !reflect.DeepEqual(again, newRows) {
+		t.Fatalf("%v %q", err, again)
+	}
+
+	// 不指定类型时只去掉空白,并按第一列排序
+	newRows, err = CanonicalizeTable(rows, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(newRows[0], []string{"CfgId", "Rate", "Name", "Color", "comment", "Unique", "Nums"}) ||
+		newRows[1][0] != "1" || newRows[2][0] != "+2" || newRows[3][0] != "10" {
+		t.Fatalf("%q", newRows)
+	}
+}
+
+func TestDiffTables(t *testing.T) {
+	type cfg struct {
+		CfgId int32
+		Name  string
+		Price int
+		Color Color
+		Nums  []int
+	}
+	option := DefaultOption
+	option.RegisterFormatterByType(reflect.TypeOf(Color(0)), func(ctx FormatContext) (string, error) {
+		return strings.TrimPrefix(Color_name[int32(ctx.FieldValue.(Color))], "Color_"), nil
+	})
+	oldTable := map[int32]*cfg{
+		1001: {CfgId: 1001, Name: "a", Price: 100, Color: Color_Color_Red, Nums: []int{1, 2}},
+		1002: {CfgId: 1002, Name: "b"},
+		10:   {CfgId: 10, Name: "c"},
+	}
+	newTable := map[int32]*cfg{
+		1001: {CfgId: 1001, Name: "a", Price: 120, Color: Color_Color_Green, Nums: []int{1, 2}},
+		10:   {CfgId: 10, Name: "c"},
+		9:    {CfgId: 9, Name: "d", Nums: []int{3}},
+	}
+	diff, err := DiffTables(oldTable, newTable, &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	diff.WriteText(&buf, "Item")
+	t.Logf("%v", buf.String())
+	expected := "Item 9: added CfgId 9, Name d, Nums 3\n" +
+		"Item 1002: removed\n" +
+		"Item 1001: Price 100 → 120\n" +
+		"Item 1001: Color Red → Green\n"
+	if buf.String() != expected {
+		t.Fatalf("%q", buf.String())
+	}
+	// csv数据按类型解析后比较,007和7,空单元格和0是一样的,key按数值排序
+	oldRows := [][]string{
+		{"CfgId", "Name", "Price", "Nums"},
+		{"1001", "a", "100", "1;2"},
+		{"1002", "b", "0", ""},
+		{"10", "c", "", ""},
+	}
+	newRows := [][]string{
+		{"CfgId", "Price", "Name", "Nums", "comment"},
+		{"1001", "0100", "a", "01;2", "注释"},
+		{"0010", "", "c", "", ""},
+		{"1002", "", "b", "", ""},
+		{"9", "1", "d", "", ""},
+	}
+	diff, err = DiffCsvData(oldRows, newRows, reflect.TypeOf(&cfg{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	diff.WriteText(&buf, "")
+	t.Logf("%v", buf.String())
+	if len(diff.Added) != 1 || diff.Added[0].Key != "9" || len(diff.Removed) != 0 || len(diff.Changed) != 0 {
+		t.Fatalf("%+v", diff)
+	}
+	// 没有类型时按单元格比较
+	diff, err = DiffCsvData(oldRows, newRows, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	diff.WriteText(&buf, "")
+	t.Logf("%v", buf.String())
+	expected = "9: added CfgId 9, Price 1, Name d\n" +
+		"0010: added CfgId 0010, Name c\n" +
+		"10: removed\n" +
+		"1001: Price 100 → 0100\n" +
+		"1001: Nums 1;2 → 01;2\n" +
+		"1001: comment  → 注释\n" +
+		"1002: Price 0 → \n"
+	if buf.String() != expected {
+		t.Fatalf("%q", buf.String())
+	}
+	// 重复的key返回错误
+	_, err = DiffCsvData(oldRows, append(newRows, []string{"9", "2", "e", ""}), reflect.TypeOf(&cfg{}), nil)
+	var duplicateKeyErr *DuplicateKeyError
+	if !errors.As(err, &duplicateKeyErr) {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestApplyCsvOverlay(t *testing.T) {
+	type cfg struct {
+		CfgId int32 `csv:",required"`
+		Name  string
+		Price int `csv:",default=100"`
+		Nums  []int
+		Rate  *float32
+	}
+	baseRows := [][]string{
+		{"CfgId", "Name", "Price", "Nums", "Rate"},
+		{"1", "普通物品1", "10", "1;2", "1.5"},
+		{"2", "普通物品2", "20", "3", ""},
+		{"3", "装备3", "30", "", ""},
+	}
+	base := make(map[int32]*cfg)
+	if err := ReadCsvFromDataMap(baseRows, base, nil); err != nil {
+		t.Fatal(err)
+	}
+	m := maps.Clone(base)
+	// 只有key列和修改的列
+	overlayRows := [][]string{
+		{"CfgId", "Price", "Nums", "#delete"},
+		{"1", "", "5;6", ""},
+		{"2", "#empty", "#empty", "false"},
+		{"3", "", "", "true"},
+		{"4", "40", "7", ""},
+		{"5", "#empty", "", ""},
+	}
+	if err := ApplyCsvOverlayFromDataMap(overlayRows, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range m {
+		t.Logf("%v:%+v", k, v)
+	}
+	rate := float32(1.5)
+	expects := map[int32]*cfg{
+		1: {CfgId: 1, Name: "普通物品1", Price: 10, Nums: []int{5, 6}, Rate: &rate},
+		2: {CfgId: 2, Name: "普通物品2", Price: 100, Rate: new(float32)},
+		4: {CfgId: 4, Price: 40, Nums: []int{7}},
+		5: {CfgId: 5, Price: 100},
+	}
+	if !reflect.DeepEqual(m, expects) {
+		t.Fatalf("%v", m)
+	}
+	// 原来的对象不会被修改
+	if len(base) != 3 || base[1].Price != 10 || !reflect.DeepEqual(base[1].Nums, []int{1, 2}) || base[2].Price != 20 {
+		t.Fatalf("%v", base)
+	}
+	// 删除标记不是bool时返回错误
+	err := ApplyCsvOverlayFromDataMap([][]string{{"CfgId", "#delete"}, {"1", "yes"}}, m, nil)
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || loadErrs[0].ColumnName != "#delete" {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestMergeTables(t *testing.T) {
+	option := DefaultOption
+	option.DataBeginRowIndex = 2
+	base := [][]string{
+		{"CfgId", "Name", "Price", "Detail"},
+		{"编号", "名字", "价格", "描述"},
+		{"1", "a", "10", "d1"},
+		{"2", "b", "20", "d2"},
+		{"3", "c", "30", "d3"},
+		{"4", "d", "40", "d4"},
+		{"5", "e", "50", "d5"},
+	}
+	// ours: 修改1的Price,删除3,新增6,修改5的Name,删除Detail列
+	ours := [][]string{
+		{"CfgId", "Name", "Price"},
+		{"编号", "名字", "价格"},
+		{"1", "a", "11"},
+		{"2", "b", "20"},
+		{"4", "d", "40"},
+		{"5", "e1", "50"},
+		{"6", "f", "60"},
+	}
+	// theirs: 修改1的Name,修改4的Price,删除2,新增7,修改5的Name,新增Rate列,调整列的顺序
+	theirs := [][]string{
+		{"CfgId", "Price", "Name", "Detail", "Rate"},
+		{"编号", "价格", "名字", "描述", "比例"},
+		{"1", "10", "a1", "d1", ""},
+		{"7", "70", "g", "", "1.5"},
+		{"3", "30", "c", "d3", ""},
+		{"4", "41", "d", "d4", ""},
+		{"5", "50", "e2", "d5", "0.5"},
+	}
+	rows, conflicts, err := MergeTables(base, ours, theirs, &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		t.Logf("%q", row)
+	}
+	expects := [][]string{
+		{"CfgId", "Name", "Price", "Rate"},
+		{"编号", "名字", "价格", "比例"},
+		{"1", "a1", "11", ""},
+		{"7", "g", "70", "1.5"},
+		{"4", "d", "41", ""},
+		{"5", "<<<<<<< ours\ne1\n=======\ne2\n>>>>>>> theirs", "50", "0.5"},
+		{"6", "f", "60", ""},
+	}
+	if !reflect.DeepEqual(rows, expects) {
+		t.Fatalf("%q", rows)
+	}
+	for _, conflict := range conflicts {
+		t.Logf("%v", conflict)
+	}
+	if len(conflicts) != 1 || conflicts[0].Row != 6 || conflicts[0].Key != "5" || conflicts[0].ColumnName != "Name" {
+		t.Fatalf("%v", conflicts)
+	}
+	// 一边删除了行,另一边修改了行
+	theirs = [][]string{
+		{"CfgId", "Name", "Price", "Detail"},
+		{"编号", "名字", "价格", "描述"},
+		{"1", "a", "10", "d1"},
+		{"2", "b", "20", "d2"},
+		{"3", "c", "31", "d3"},
+		{"4", "d", "40", "d4"},
+		{"5", "e", "50", "d5"},
+	}
+	rows, conflicts, err = MergeTables(base, ours, theirs, &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, conflict := range conflicts {
+		t.Logf("%v", conflict)
+	}
+	if len(conflicts) != 1 || conflicts[0].Row != 5 || conflicts[0].ColumnName != "" || rows[4][0] != "<<<<<<< ours\n\n=======\n3\n>>>>>>> theirs" {
+		t.Fatalf("%v %q", conflicts, rows)
+	}
+	// 重复的key无法合并
+	_, _, err = MergeTables(base, append(ours, []string{"6", "f2", "61"}), theirs, &option)
+	var duplicateKeyErr *DuplicateKeyError
+	if !errors.As(err, &duplicateKeyErr) {
+		t.Fatalf("%v", err)
+	}
+	// base为空时,两边新增的同一行按单元格合并
+	addOurs := [][]string{{"CfgId", "Name"}, {"1", "a"}, {"2", "b"}}
+	addTheirs := [][]string{{"CfgId", "Name"}, {"1", "a"}, {"2", "c"}}
+	rows, conflicts, err = MergeTables(nil, addOurs, addTheirs, nil)
+	if err != nil || len(conflicts) != 1 || conflicts[0].ColumnName != "Name" || rows[1][1] != "a" {
+		t.Fatalf("%v %v %q", err, conflicts, rows)
+	}
+}
+
+func TestFieldSeparators(t *testing.T) {
+	type area struct {
+		Name   string
+		Points []int32 `csv:",sep=,"`
+	}
+	type cfg struct {
+		CfgId  int32
+		Pos    []float64 `csv:",sep=,"`
+		Reward ItemNum
+		Path   []string
+		Attrs  map[string]int `csv:",kv=:,pair=,"`
+		Area   area
+	}
+	rows := [][]string{
+		{"CfgId", "Pos", "Reward", "Path", "Attrs", "Area"},
+		{"1", "1.5,2", "CfgId_1#Num_2", "a|b;c", "atk:2,hp:1", "Name_x#Points_1,2,3"},
+	}
+	option := DefaultOption
+	// tag里的分隔符优先
+	option.RegisterSeparatorsByColumnName("Path", Separators{Slice: "|"})
+	option.RegisterSeparatorsByColumnName("Pos", Separators{Slice: "|"})
+	s, err := ReadCsvFromDataSlice(rows, []*cfg(nil), &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &cfg{
+		CfgId:  1,
+		Pos:    []float64{1.5, 2},
+		Reward: ItemNum{CfgId: 1, Num: 2},
+		Path:   []string{"a", "b;c"},
+		Attrs:  map[string]int{"atk": 2, "hp": 1},
+		Area:   area{Name: "x", Points: []int32{1, 2, 3}},
+	}
+	if len(s) != 1 || !reflect.DeepEqual(s[0], expect) {
+		t.Fatalf("%+v", s[0])
+	}
+	writeRows, err := WriteCsvToDataSlice(s, &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%q", writeRows)
+	if !reflect.DeepEqual(writeRows, rows) {
+		t.Fatalf("%q", writeRows)
+	}
+	// 值里的字段分隔符会被转义
+	s[0].Path = []string{"a|b"}
+	writeRows, err = WriteCsvToDataSlice(s, &option)
+	if err != nil || writeRows[1][3] != `a\|b` {
+		t.Fatalf("%q %v", writeRows, err)
+	}
+}
+
+func TestCsvTag(t *testing.T) {
+	type cfg struct {
+		CfgId int32  `json:"id" protobuf:"varint,1,opt,name=cfg_id"`
+		Name  string `json:"name" csv:"item_name"`
+		Price int    `csv:"Name"`
+		Memo  string `csv:"-"`
+		Note  string `csv:",ignore"`
+		Level int8   `csv:",strict"`
+		Tag   string `csv:",omitempty"`
+	}
+	rows := [][]string{
+		{"cfg_id", "item_name", "Name", "Memo", "Note", "Level", "name"},
+		{"1", "普通物品1", "100", "memo", "note", "1", "json"},
+		{"2", "普通物品2", "200", "memo", "note", "300", "json"},
+	}
+	option := DefaultOption
+	collector := &DiagnosticsCollector{}
+	option.Diagnostics = collector
+	m := make(map[int32]*cfg)
+	err := ReadCsvFromDataMap(rows, m, &option)
+	// Level按严格模式解析
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || len(loadErrs) != 1 || loadErrs[0].ColumnName != "Level" {
+		t.Fatalf("%v", err)
+	}
+	// csv tag里的列名优先,有csv tag列名的字段不再使用字段名和json别名,csv:"-"的字段不赋值
+	if !reflect.DeepEqual(m[1], &cfg{CfgId: 1, Name: "普通物品1", Price: 100, Level: 1}) {
+		t.Fatalf("%+v", m[1])
+	}
+	// Memo和name是未知的列,Note被忽略
+	warnings := collector.Diagnostics(SeverityWarning)
+	for _, d := range warnings {
+		t.Logf("%v", d)
+	}
+	if len(warnings) != 2 || warnings[0].ColumnName != "Memo" || warnings[1].ColumnName != "name" {
+		t.Fatalf("%v", warnings)
+	}
+	// 写入时不写入csv:"-"和ignore的字段,omitempty的列都为空时不写入
+	newRows, err := WriteCsvToDataMap(m, &option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range newRows {
+		t.Logf("%q", row)
+	}
+	expects := [][]string{
+		{"CfgId", "item_name", "Name", "Level"},
+		{"1", "普通物品1", "100", "1"},
+		{"2", "普通物品2", "200", ""},
+	}
+	if !reflect.DeepEqual(newRows, expects) {
+		t.Fatalf("%q", newRows)
+	}
+	m[2].Tag = "tag"
+	newRows, _ = WriteCsvToDataMap(m, &option)
+	if !reflect.DeepEqual(newRows[0], []string{"CfgId", "item_name", "Name", "Level", "Tag"}) {
+		t.Fatalf("%q", newRows)
+	}
+
+	// 子结构的字段也一样
+	type sub struct {
+		A    int32
+		Memo string `csv:"-"`
+		Note string `csv:",ignore"`
+	}
+	s, err := ConvertFieldValueToString(reflect.ValueOf(sub{A: 1, Memo: "secret", Note: "note"}), "", &DefaultOption)
+	if err != nil || s != "A_1" {
+		t.Fatalf("%v %q", err, s)
+	}
+	s, err = ConvertFieldValueToString(reflect.ValueOf(sub{Memo: "secret"}), "", &DefaultOption)
+	if err != nil || s != "A_0" {
+		t.Fatalf("%v %q", err, s)
+	}
+	var subVal sub
+	subObj := reflect.ValueOf(&subVal)
+	err = ConvertStringToFieldValue(subObj, subObj.Elem(), "", "A_1#Note_x", &DefaultOption, false)
+	if err != nil || !reflect.DeepEqual(subVal, sub{A: 1}) {
+		t.Fatalf("%v %+v", err, subVal)
+	}
+	err = ConvertStringToFieldValue(subObj, subObj.Elem(), "", "A_1#Memo_x", &DefaultOption, false)
+	t.Logf("%v", err)
+	if !errors.Is(err, ErrUnknownField) || subVal.Memo != "" {
+		t.Fatalf("%v %+v", err, subVal)
+	}
+}
+
+func TestKeyColumn(t *testing.T) {
+	type skillLevelCfg struct {
+		Name    string
+		SkillId int32 `csv:",key"`
+		Level   int32 `csv:",key"`
+		Damage  int
+	}
+	type skillLevelKey struct {
+		SkillId int32
+		Level   int32
+	}
+	rows := [][]string{
+		{"Name", "SkillId", "Level", "Damage"},
+		{"火球", "1", "1", "100"},
+		{"火球", "1", "2", "150"},
+		{"冰箭", "2", "1", "80"},
+	}
+	// 结构体的组合key
+	m := make(map[skillLevelKey]*skillLevelCfg)
+	if err := ReadCsvFromDataKeyMap(rows, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range m {
+		t.Logf("%+v:%+v", k, v)
+	}
+	if len(m) != 3 || m[skillLevelKey{1, 2}].Damage != 150 {
+		t.Fatalf("%v", m)
+	}
+	// 嵌套的map
+	nested := make(map[int32]map[int32]*skillLevelCfg)
+	if err := ReadCsvFromDataKeyMap(rows, nested, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(nested) != 2 || len(nested[1]) != 2 || nested[2][1].Name != "冰箭" {
+		t.Fatalf("%v", nested)
+	}
+	// 写入时key列写入字段的值,按key排序
+	newRows, err := WriteCsvToDataKeyMap(nested, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(newRows, rows) {
+		t.Fatalf("%q", newRows)
+	}
+	newRows, err = WriteCsvToDataKeyMap(m, nil)
+	if err != nil || !reflect.DeepEqual(newRows, rows) {
+		t.Fatalf("%v %q", err, newRows)
+	}
+	// 重复的组合key
+	err = ReadCsvFromDataKeyMap(append(rows, []string{"火球2", "1", "2", "200"}), make(map[skillLevelKey]*skillLevelCfg), nil)
+	var duplicateKeyErr *DuplicateKeyError
+	if !errors.As(err, &duplicateKeyErr) || duplicateKeyErr.Key != "1,2" {
+		t.Fatalf("%v", err)
+	}
+	// key列的数量和map的key不一致
+	err = ReadCsvFromDataKeyMap(rows, make(map[int32]*skillLevelCfg), nil)
+	if !errors.Is(err, ErrKeyColumn) {
+		t.Fatalf("%v", err)
+	}
+	// key列的自定义转换接口panic时,转换成错误
+	panicOption := DefaultOption
+	panicOption.RegisterConverterByColumnName("Level", func(obj any, columnName, fieldStr string) any {
+		panic("converter bug")
+	})
+	err = ReadCsvFromDataKeyMap(rows, make(map[skillLevelKey]*skillLevelCfg), &panicOption)
+	var loadErrs LoadErrors
+	if !errors.Is(err, ErrPanic) || !errors.As(err, &loadErrs) || loadErrs[0].ColumnName != "Level" || loadErrs[0].Row != 2 {
+		t.Fatalf("%v", err)
+	}
+	// 按列名指定key列
+	type itemCfg struct {
+		Name  string
+		CfgId int32
+	}
+	option := DefaultOption
+	option.KeyColumnNames = []string{"CfgId"}
+	items := make(map[int32]*itemCfg)
+	itemRows := [][]string{
+		{"Name", "CfgId"},
+		{"a", "1"},
+		{"b", "2"},
+	}
+	if err = ReadCsvFromDataMap(itemRows, items, &option); err != nil {
+		t.Fatal(err)
+	}
+	if items[2].Name != "b" {
+		t.Fatalf("%v", items)
+	}
+	newRows, err = WriteCsvToDataMap(items, &option)
+	if err != nil || !reflect.DeepEqual(newRows, itemRows) {
+		t.Fatalf("%v %q", err, newRows)
+	}
+	option.KeyColumnNames = []string{"Id"}
+	err = ReadCsvFromDataMap(itemRows, items, &option)
+	if !errors.Is(err, ErrMissingColumn) {
+		t.Fatalf("%v", err)
+	}
+
+	// 合并,比较,格式化也使用组合key
+	option.KeyColumnNames = []string{"A", "B"}
+	baseRows := [][]string{
+		{"A", "B", "Value"},
+		{"1", "2", "x"},
+		{"1", "1", "y"},
+	}
+	oursRows := [][]string{
+		{"A", "B", "Value"},
+		{"1", "2", "x2"},
+		{"1", "1", "y"},
+	}
+	theirsRows := [][]string{
+		{"A", "B", "Value"},
+		{"1", "2", "x"},
+		{"1", "1", "y"},
+		{"1", "3", "z"},
+	}
+	merged, conflicts, err := MergeTables(baseRows, oursRows, theirsRows, &option)
+	if err != nil || len(conflicts) > 0 {
+		t.Fatalf("%v %v", err, conflicts)
+	}
+	t.Logf("%q", merged)
+	if !reflect.DeepEqual(merged, [][]string{{"A", "B", "Value"}, {"1", "2", "x2"}, {"1", "1", "y"}, {"1", "3", "z"}}) {
+		t.Fatalf("%q", merged)
+	}
+	diff, err := DiffCsvData(baseRows, theirsRows, nil, &option)
+	if err != nil || len(diff.Added) != 1 || diff.Added[0].Key != "1,3" || len(diff.Changed) != 0 {
+		t.Fatalf("%v %+v", err, diff)
+	}
+	canonicalRows, err := CanonicalizeTable(theirsRows, nil, &option)
+	if err != nil || !reflect.DeepEqual(canonicalRows[1:], [][]string{{"1", "1", "y"}, {"1", "2", "x"}, {"1", "3", "z"}}) {
+		t.Fatalf("%v %q", err, canonicalRows)
+	}
+	_, _, err = MergeTables(baseRows, append(oursRows, []string{"1", "2", "dup"}), theirsRows, &option)
+	if !errors.As(err, new(*DuplicateKeyError)) {
+		t.Fatalf("%v", err)
+	}
+}
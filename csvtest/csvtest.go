@@ -0,0 +1,265 @@
+// Package csvtest 检查数据写入csv之后,能否被读取成一样的数据
+//
+// 随机生成结构体的值(包括数组,map,指针和子结构),用csv.WriteCsvToDataSlice写入,
+// 再用csv.ReadCsvFromDataSlice读取回来,和原始数据比较
+package csvtest
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+
+	"github.com/fish-tennis/csv"
+)
+
+// 随机字符串使用的字符,包含默认的分隔符,{},转义字符和空白字符
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789物品装备;_#{}\\|:, \t"
+
+// 生成随机值的设置
+type Generator struct {
+	Rand *rand.Rand
+	// 数组和map的最大长度
+	MaxLen int
+	// 字符串的最大长度
+	MaxStringLen int
+}
+
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		Rand:         rand.New(rand.NewSource(seed)),
+		MaxLen:       4,
+		MaxStringLen: 8,
+	}
+}
+
+// 生成typ类型的随机值
+// 生成的值都可以用csv的格式表示:
+//   - 行对象和行对象的指针字段不为nil,因为nil的行不会写入,空单元格读取时会分配零值
+//   - 数组和map可能为nil,也可能是空的,读取回来都是nil,见RoundTrip
+//   - 字符串可能为空,可能包含分隔符和首尾的空白,分隔符写入时需要转义(CsvOption.EscapeChar)
+//   - 数组的元素是字符串或[]byte时不为空,因为空的元素无法写入(csv.ErrSliceElem)
+//   - 未导出的字段,以及不支持的类型(如chan,func,interface,complex)为零值
+func (g *Generator) Value(typ reflect.Type) reflect.Value {
+	v := reflect.New(typ).Elem()
+	g.fill(v, 0)
+	return v
+}
+
+// depth: 0表示行对象,1表示行对象的字段,2表示子结构的字段
+func (g *Generator) fill(v reflect.Value, depth int) {
+	r := g.Rand
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bits := v.Type().Bits()
+		n := r.Int63() >> (64 - bits)
+		if r.Intn(2) == 0 {
+			n = -n
+		}
+		if r.Intn(4) == 0 {
+			n = 0
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		bits := v.Type().Bits()
+		n := r.Uint64() >> (64 - bits)
+		if r.Intn(4) == 0 {
+			n = 0
+		}
+		v.SetUint(n)
+	case reflect.Float32:
+		v.SetFloat(float64(float32(r.NormFloat64() * 1000)))
+	case reflect.Float64:
+		v.SetFloat(r.NormFloat64() * 1000)
+	case reflect.Bool:
+		v.SetBool(r.Intn(2) == 0)
+	case reflect.String:
+		v.SetString(g.String())
+	case reflect.Ptr:
+		if depth <= 1 || r.Intn(4) != 0 {
+			elem := reflect.New(v.Type().Elem())
+			g.fill(elem.Elem(), depth)
+			v.Set(elem)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				g.fill(v.Field(i), depth+1)
+			}
+		}
+	case reflect.Slice:
+		n := r.Intn(g.MaxLen + 1)
+		if n == 0 {
+			if r.Intn(2) == 0 {
+				v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+			}
+			return
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(g.String()))
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			elem := s.Index(i)
+			if elem.Kind() == reflect.Ptr {
+				// 数组的元素不能为nil
+				elem.Set(reflect.New(elem.Type().Elem()))
+				elem = elem.Elem()
+			}
+			g.fill(elem, depth)
+			if (elem.Kind() == reflect.String || elem.Kind() == reflect.Slice && elem.Type().Elem().Kind() == reflect.Uint8) && elem.Len() == 0 {
+				// 空的元素无法写入
+				elem.Set(reflect.ValueOf(g.nonEmptyString()).Convert(elem.Type()))
+			}
+		}
+		v.Set(s)
+	case reflect.Map:
+		n := r.Intn(g.MaxLen + 1)
+		if n == 0 {
+			if r.Intn(2) == 0 {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			return
+		}
+		m := reflect.MakeMapWithSize(v.Type(), n)
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			g.fill(key, depth)
+			value := reflect.New(v.Type().Elem()).Elem()
+			g.fill(value, depth)
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	}
+}
+
+// 随机字符串,可能为空
+func (g *Generator) String() string {
+	if g.Rand.Intn(8) == 0 {
+		return ""
+	}
+	return g.nonEmptyString()
+}
+
+// 随机的非空字符串
+func (g *Generator) nonEmptyString() string {
+	runes := []rune(letters)
+	n := 1 + g.Rand.Intn(g.MaxStringLen)
+	s := make([]rune, n)
+	for i := range s {
+		s[i] = runes[g.Rand.Intn(len(runes))]
+	}
+	return string(s)
+}
+
+// 生成count个V类型的随机值
+func RandomSlice[V any](g *Generator, count int) []V {
+	s := make([]V, count)
+	typ := reflect.TypeOf(s).Elem()
+	for i := range s {
+		s[i] = g.Value(typ).Interface().(V)
+	}
+	return s
+}
+
+// values写入csv数据,再读取回来,检查和原始数据是否一致
+// 空的数组和map读取回来是nil,比较时视为一样(见Equal),其他的值必须完全一致,包括字符串首尾的空白
+// 不一致时返回的错误带有csv数据,方便定位问题
+func RoundTrip[V any](values []V, option *csv.CsvOption) error {
+	rows, err := csv.WriteCsvToDataSlice(values, option)
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	readValues, err := csv.ReadCsvFromDataSlice(rows, []V(nil), option)
+	if err != nil {
+		return fmt.Errorf("read: %w\nrows: %q", err, rows)
+	}
+	if len(readValues) != len(values) {
+		return fmt.Errorf("len mismatch: want %v, got %v\nrows: %q", len(values), len(readValues), rows)
+	}
+	for i := range values {
+		if !Equal(values[i], readValues[i]) {
+			return fmt.Errorf("value[%v] mismatch:\nwant %+v\ngot  %+v\nrows: %q", i, deref(values[i]), deref(readValues[i]), rows)
+		}
+	}
+	return nil
+}
+
+// 和reflect.DeepEqual一样比较a和b,但是nil和空的数组,map视为一样
+// csv无法区分nil和空的数组,map,读取时空的单元格不会分配
+func Equal(a, b any) bool {
+	return equalValue(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func equalValue(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalValue(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			bValue := b.MapIndex(iter.Key())
+			if !bValue.IsValid() || !equalValue(iter.Value(), bValue) {
+				return false
+			}
+		}
+		return true
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equalValue(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !equalValue(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.String:
+		return a.String() == b.String()
+	}
+	if a.CanInterface() && b.CanInterface() {
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+	// 未导出的不支持的类型,只比较是否为零值
+	return a.IsZero() == b.IsZero()
+}
+
+// 随机生成count个V类型的值,检查RoundTrip
+func RandomRoundTrip[V any](seed int64, count int, option *csv.CsvOption) error {
+	return RoundTrip(RandomSlice[V](NewGenerator(seed), count), option)
+}
+
+func deref(v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		return rv.Elem().Interface()
+	}
+	return v
+}
@@ -0,0 +1,183 @@
+package csvtest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/fish-tennis/csv"
+)
+
+type itemNum struct {
+	CfgId int32
+	Num   *int64
+	Rate  float32
+}
+
+type cfgArgs struct {
+	CfgId int32
+	Args  []int32
+	Name  string
+}
+
+// 多层嵌套的子结构
+type childCfg struct {
+	Name    string
+	Item    *itemNum
+	Items   []itemNum
+	Args    cfgArgs
+	Rewards map[int32]itemNum
+}
+
+type testCfg struct {
+	CfgId  int32
+	Name   string
+	Unique bool
+	Price  *uint16
+	Rate   float64
+	Item   itemNum
+	ItemP  *itemNum
+	Args   cfgArgs
+	Items  []itemNum
+	ItemPs []*itemNum
+	Nums   []int8
+	Names  []string
+	Attrs  map[string]int32
+	Levels map[int32]float32
+	Data   []byte
+	// 多层嵌套
+	Children []childCfg
+	Rewards  map[string]*itemNum
+	Groups   [][]int32
+}
+
+func TestRoundTrip(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		if err := RandomRoundTrip[*testCfg](seed, 10, nil); err != nil {
+			t.Fatalf("seed %v: %v", seed, err)
+		}
+		if err := RandomRoundTrip[testCfg](seed, 10, nil); err != nil {
+			t.Fatalf("seed %v: %v", seed, err)
+		}
+	}
+	values := RandomSlice[*testCfg](NewGenerator(1), 2)
+	rows, err := csv.WriteCsvToDataSlice(values, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		t.Logf("%q", row)
+	}
+}
+
+func TestRoundTripOption(t *testing.T) {
+	option := csv.DefaultOption
+	option.SliceSeparator = "|"
+	option.KvSeparator = ":"
+	option.PairSeparator = ","
+	option.DataBeginRowIndex = 3
+	option.ColumnNameRowIndex = 1
+	option.Strict = true
+	for seed := int64(0); seed < 100; seed++ {
+		if err := RandomRoundTrip[*testCfg](seed, 10, &option); err != nil {
+			t.Fatalf("seed %v: %v", seed, err)
+		}
+	}
+}
+
+func TestRoundTripSeparator(t *testing.T) {
+	values := RandomSlice[*testCfg](NewGenerator(1), 10)
+	values[0].Names = []string{"a;b", "c_d#e", "{f}", `g\`}
+	if err := RoundTrip(values, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 不转义时,值里的分隔符无法写入
+	option := csv.DefaultOption
+	option.EscapeChar = ""
+	if err := RoundTrip(values, &option); err == nil {
+		t.Fatal("expect error")
+	} else {
+		t.Logf("%v", err)
+	}
+}
+
+// 空字符串,首尾空白,空的数组和map
+func TestRoundTripEmpty(t *testing.T) {
+	values := []*testCfg{
+		{
+			CfgId:  1,
+			Name:   " \tname ",
+			Price:  new(uint16),
+			ItemP:  &itemNum{},
+			Item:   itemNum{CfgId: 1},
+			Args:   cfgArgs{Args: []int32{}, Name: " "},
+			Items:  []itemNum{},
+			Nums:   []int8{},
+			Names:  []string{" a", "\tb\t", " "},
+			Attrs:  map[string]int32{},
+			Levels: map[int32]float32{},
+			Data:   []byte{},
+			Rewards: map[string]*itemNum{
+				"":    {CfgId: 2},
+				" k ": {},
+			},
+			Groups: [][]int32{{}, nil, {1}},
+		},
+		{
+			CfgId: 2,
+			Name:  "   ",
+			Price: new(uint16),
+			ItemP: &itemNum{},
+			Attrs: map[string]int32{"": 0, " ": 1},
+		},
+	}
+	if err := RoundTrip(values, nil); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.WriteCsvToDataSlice(values, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readValues, err := csv.ReadCsvFromDataSlice(rows, []*testCfg(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空的数组和map读取回来是nil
+	v := readValues[0]
+	if v.Items != nil || v.Nums != nil || v.Attrs != nil || v.Levels != nil || v.Data != nil || v.Args.Args != nil {
+		t.Fatalf("expect nil: %+v", v)
+	}
+	if reflect.DeepEqual(values[0], v) || !Equal(values[0], v) {
+		t.Fatal("expect nil == empty")
+	}
+	// 首尾空白保留
+	if v.Name != " \tname " || v.Args.Name != " " || readValues[1].Name != "   " {
+		t.Fatalf("space mismatch: %q %q %q", v.Name, v.Args.Name, readValues[1].Name)
+	}
+	t.Logf("%+v", v)
+	// 数组的元素不能为空字符串
+	values[1].Names = []string{"a", ""}
+	if _, err := csv.WriteCsvToDataSlice(values, nil); !errors.Is(err, csv.ErrSliceElem) {
+		t.Fatalf("expect ErrSliceElem: %v", err)
+	} else {
+		t.Logf("%v", err)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	if !Equal(&testCfg{Names: []string{}, Attrs: map[string]int32{}}, &testCfg{}) {
+		t.Fatal("expect nil == empty")
+	}
+	if Equal(&testCfg{Names: []string{""}}, &testCfg{}) {
+		t.Fatal("expect not equal")
+	}
+	if Equal(&testCfg{Name: " "}, &testCfg{}) {
+		t.Fatal("expect not equal")
+	}
+	if Equal(&testCfg{Attrs: map[string]int32{"a": 0}}, &testCfg{Attrs: map[string]int32{"b": 0}}) {
+		t.Fatal("expect not equal")
+	}
+	if !Equal([][]int32{{}, nil}, [][]int32{nil, {}}) {
+		t.Fatal("expect nil == empty")
+	}
+}
@@ -0,0 +1,117 @@
+// Package csvtool 命令行工具的公共部分
+//
+// 项目可以在自己的main里注册配置表对应的类型和CsvOption(如自定义的转换和格式化接口),再调用FmtMain等接口
+//
+//	func main() {
+//		option := csv.DefaultOption
+//		option.RegisterConverterByType(...)
+//		csvtool.RegisterType("ItemCfg", reflect.TypeOf(&pb.ItemCfg{}), &option)
+//		os.Exit(csvtool.FmtMain(os.Args[1:]))
+//	}
+package csvtool
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/fish-tennis/csv"
+)
+
+type registeredType struct {
+	typ    reflect.Type
+	option *csv.CsvOption
+}
+
+var registeredTypes = make(map[string]*registeredType)
+
+// 注册配置表一行数据对应的类型,如*pb.ItemCfg,命令行中用-type name指定
+// option为nil时使用csv.DefaultOption
+func RegisterType(name string, typ reflect.Type, option *csv.CsvOption) {
+	registeredTypes[name] = &registeredType{
+		typ:    typ,
+		option: option,
+	}
+}
+
+// 已注册的类型名,按名字排序
+func TypeNames() []string {
+	names := make([]string, 0, len(registeredTypes))
+	for name := range registeredTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 公共的命令行参数
+type commonFlags struct {
+	typeName           string
+	src                string
+	columnNameRowIndex int
+	dataBeginRowIndex  int
+	strict             bool
+}
+
+func (f *commonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.typeName, "type", "", "注册的类型名,有-src时是源文件里的结构体名,为空时不按类型解析单元格")
+	fs.IntVar(&f.columnNameRowIndex, "header", -1, "表头的行索引,-1表示使用注册的CsvOption")
+	fs.IntVar(&f.dataBeginRowIndex, "data", -1, "数据行索引,-1表示使用注册的CsvOption")
+}
+
+// 解析单元格的命令才有-src和-strict,如csvmerge只按字符串合并,不需要
+func (f *commonFlags) registerParse(fs *flag.FlagSet) {
+	fs.StringVar(&f.src, "src", "", "Go源文件,和-type一起使用,按源文件里的结构体解析单元格,不需要注册类型")
+	fs.BoolVar(&f.strict, "strict", false, "严格模式")
+}
+
+// 根据命令行参数,返回类型和CsvOption
+// 注册的CsvOption没有设置Diagnostics时,警告输出到stderr,错误由命令输出
+func (f *commonFlags) typeAndOption(stderr io.Writer) (reflect.Type, *csv.CsvOption, error) {
+	var typ reflect.Type
+	option := csv.DefaultOption
+	if f.src != "" {
+		if f.typeName == "" {
+			return nil, nil, fmt.Errorf("-src needs -type")
+		}
+		var err error
+		if typ, err = TypeFromSource(f.src, f.typeName); err != nil {
+			return nil, nil, err
+		}
+	} else if f.typeName != "" {
+		registered, ok := registeredTypes[f.typeName]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown type %v, registered types: %v", f.typeName, TypeNames())
+		}
+		typ = registered.typ
+		if registered.option != nil {
+			option = *registered.option
+		}
+	}
+	if f.columnNameRowIndex >= 0 {
+		option.ColumnNameRowIndex = f.columnNameRowIndex
+	}
+	if f.dataBeginRowIndex >= 0 {
+		option.DataBeginRowIndex = f.dataBeginRowIndex
+	}
+	if f.strict {
+		option.Strict = true
+	}
+	if option.Diagnostics == nil {
+		option.Diagnostics = &warningWriter{w: stderr}
+	}
+	return typ, &option, nil
+}
+
+// 只输出警告,错误会作为error返回,由命令输出
+type warningWriter struct {
+	w io.Writer
+}
+
+func (w *warningWriter) Report(d csv.Diagnostic) {
+	if d.Severity == csv.SeverityWarning {
+		fmt.Fprintln(w.w, d)
+	}
+}
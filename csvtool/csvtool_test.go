@@ -0,0 +1,177 @@
+package csvtool
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fish-tennis/csv"
+)
+
+type itemCfg struct {
+	CfgId  int32
+	Name   string
+	Unique bool
+	Price  int
+}
+
+func init() {
+	option := csv.DefaultOption
+	option.Diagnostics = csv.NopDiagnostics
+	RegisterType("ItemCfg", reflect.TypeOf(&itemCfg{}), &option)
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestFmtMain(t *testing.T) {
+	file := writeFile(t, "item.csv", "CfgId,Price, Name ,Unique\r\n2,0100,b,0\r\n1,10, a ,TRUE\r\n,,,\r\n")
+	var stdout, stderr bytes.Buffer
+	if code := fmtMain([]string{"-check", "-type", "ItemCfg", file}, &stdout, &stderr); code != 1 || stdout.String() != file+"\n" {
+		t.Fatalf("%v %q %q", code, stdout.String(), stderr.String())
+	}
+	if code := fmtMain([]string{"-type", "ItemCfg", file}, &stdout, &stderr); code != 0 {
+		t.Fatalf("%v %q", code, stderr.String())
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%s", data)
+	if string(data) != "CfgId,Name,Unique,Price\n1,a,true,10\n2,b,false,100\n" {
+		t.Fatalf("%q", data)
+	}
+	stdout.Reset()
+	if code := fmtMain([]string{"-check", "-type", "ItemCfg", file}, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Fatalf("%v %q %q", code, stdout.String(), stderr.String())
+	}
+	if code := fmtMain([]string{"-type", "Unknown", file}, &stdout, &stderr); code != 2 {
+		t.Fatalf("%v", code)
+	}
+
+	// 不注册类型,按Go源文件里的结构体规范化
+	src := writeFile(t, "item.go", `package cfg
+
+type Color int32
+
+type ItemNum struct {
+	CfgId int32
+	Num   int32
+}
+
+type ItemCfg struct {
+	CfgId  int32
+	Name   string `+"`csv:\"item_name\"`"+`
+	Unique bool
+	Color  Color
+	Items  []*ItemNum
+	Attrs  map[string]float32
+	Other  pb.Other
+	memo   string
+}
+`)
+	file = writeFile(t, "item.csv", "CfgId,item_name,Unique,Color,Items,Attrs,Other\n2,b,1,+3,CfgId_01#Num_2,hp_1.50,x\n1,a,FALSE,0,,,y\n")
+	if code := fmtMain([]string{"-src", src, "-type", "ItemCfg", file}, &stdout, &stderr); code != 0 {
+		t.Fatalf("%v %q", code, stderr.String())
+	}
+	if data, _ = os.ReadFile(file); string(data) != "CfgId,item_name,Unique,Color,Items,Attrs,Other\n1,a,false,0,,,y\n2,b,true,3,CfgId_1#Num_2,hp_1.5,x\n" {
+		t.Fatalf("%q", data)
+	}
+	if code := fmtMain([]string{"-src", src, "-type", "Unknown", file}, &stdout, &stderr); code != 2 {
+		t.Fatalf("%v", code)
+	}
+}
+
+func TestDiffMain(t *testing.T) {
+	oldFile := writeFile(t, "old.csv", "CfgId,Name,Unique,Price\n1001,a,false,100\n1002,b,true,50\n")
+	newFile := writeFile(t, "new.csv", "CfgId,Price,Name,Unique\n1003,10,c,\n1001,120,a,0\n")
+	var stdout, stderr bytes.Buffer
+	if code := diffMain([]string{"-type", "ItemCfg", oldFile, newFile}, &stdout, &stderr); code != 1 {
+		t.Fatalf("%v %q", code, stderr.String())
+	}
+	t.Logf("%s", stdout.String())
+	expected := "ItemCfg 1003: added CfgId 1003, Name c, Price 10\n" +
+		"ItemCfg 1002: removed\n" +
+		"ItemCfg 1001: Price 100 → 120\n"
+	if stdout.String() != expected {
+		t.Fatalf("%q", stdout.String())
+	}
+	stdout.Reset()
+	if code := diffMain([]string{"-json", oldFile, newFile}, &stdout, &stderr); code != 1 {
+		t.Fatalf("%v %q", code, stderr.String())
+	}
+	t.Logf("%s", stdout.String())
+	var diff csv.TableDiff
+	if err := json.Unmarshal(stdout.Bytes(), &diff); err != nil {
+		t.Fatal(err)
+	}
+	// 没有类型时按单元格比较,false和0不同
+	if len(diff.Added) != 1 || len(diff.Removed) != 1 || len(diff.Changed) != 1 || len(diff.Changed[0].Fields) != 2 {
+		t.Fatalf("%+v", diff)
+	}
+	stdout.Reset()
+	if code := diffMain([]string{"-type", "ItemCfg", newFile, newFile}, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Fatalf("%v %q", code, stdout.String())
+	}
+}
+
+func TestMergeMain(t *testing.T) {
+	baseFile := writeFile(t, "base.csv", "CfgId,Name,Price\n1,a,10\n2,b,20\n")
+	oursFile := writeFile(t, "ours.csv", "CfgId,Name,Price\n1,a,11\n2,b,20\n")
+	theirsFile := writeFile(t, "theirs.csv", "CfgId,Name,Price\n1,a1,10\n2,b,20\n3,c,30\n")
+	var stderr bytes.Buffer
+	if code := mergeMain([]string{baseFile, oursFile, theirsFile}, &stderr); code != 0 {
+		t.Fatalf("%v %q", code, stderr.String())
+	}
+	data, err := os.ReadFile(oursFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%s", data)
+	if string(data) != "CfgId,Name,Price\n1,a1,11\n2,b,20\n3,c,30\n" {
+		t.Fatalf("%q", data)
+	}
+	// 两边都修改了同一个单元格
+	theirsFile = writeFile(t, "theirs.csv", "CfgId,Name,Price\n1,a,12\n2,b,20\n")
+	if code := mergeMain([]string{baseFile, oursFile, theirsFile}, &stderr); code != 1 {
+		t.Fatalf("%v %q", code, stderr.String())
+	}
+	t.Logf("%s", stderr.String())
+	data, err = os.ReadFile(oursFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("\"<<<<<<< ours\n11\n=======\n12\n>>>>>>> theirs\"")) {
+		t.Fatalf("%q", data)
+	}
+	// git的add/add冲突,base是空文件
+	emptyFile := writeFile(t, "empty.csv", "")
+	oursFile = writeFile(t, "ours.csv", "CfgId,Name,Price\n1,a,10\n")
+	theirsFile = writeFile(t, "theirs.csv", "CfgId,Name,Price\n1,a,10\n2,b,20\n")
+	stderr.Reset()
+	if code := mergeMain([]string{emptyFile, oursFile, theirsFile}, &stderr); code != 0 {
+		t.Fatalf("%v %q", code, stderr.String())
+	}
+	if data, _ = os.ReadFile(oursFile); string(data) != "CfgId,Name,Price\n1,a,10\n2,b,20\n" {
+		t.Fatalf("%q", data)
+	}
+	// 错误信息里是出错的文件
+	stderr.Reset()
+	if code := mergeMain([]string{baseFile, oursFile, emptyFile}, &stderr); code != 2 || !strings.Contains(stderr.String(), "empty.csv") {
+		t.Fatalf("%v %q", code, stderr.String())
+	}
+	t.Logf("%s", stderr.String())
+	// csvmerge没有-strict
+	if code := mergeMain([]string{"-strict", baseFile, oursFile, theirsFile}, &stderr); code != 2 {
+		t.Fatalf("%v", code)
+	}
+}
@@ -0,0 +1,73 @@
+package csvtool
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fish-tennis/csv"
+)
+
+// csvdiff命令,按key比较两个版本的csv文件,规则见csv.DiffCsvFiles
+//
+//	csvdiff [-json] [-name Item] [-type name [-src file.go]] [-header 0] [-data 1] old.csv new.csv
+//
+// 没有差异时返回0,有差异时返回1,出错时返回2,和diff命令一样
+func DiffMain(args []string) int {
+	return diffMain(args, os.Stdout, os.Stderr)
+}
+
+func diffMain(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("csvdiff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags commonFlags
+	flags.register(fs)
+	flags.registerParse(fs)
+	jsonOutput := fs.Bool("json", false, "输出json格式")
+	name := fs.String("name", "", "文本输出时每行的前缀,默认是-type的类型名,没有类型时是文件名")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(stderr, "usage: csvdiff [-json] [-name Item] [-type name [-src file.go]] [-header 0] [-data 1] old.csv new.csv")
+		fs.PrintDefaults()
+		return 2
+	}
+	typ, option, err := flags.typeAndOption(stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	oldFile, newFile := fs.Arg(0), fs.Arg(1)
+	diff, err := csv.DiffCsvFiles(oldFile, newFile, typ, option)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(diff)
+	} else {
+		tableName := *name
+		if tableName == "" {
+			tableName = flags.typeName
+		}
+		if tableName == "" {
+			tableName = strings.TrimSuffix(filepath.Base(newFile), filepath.Ext(newFile))
+		}
+		err = diff.WriteText(stdout, tableName)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if diff.IsEmpty() {
+		return 0
+	}
+	return 1
+}
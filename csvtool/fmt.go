@@ -0,0 +1,80 @@
+package csvtool
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/fish-tennis/csv"
+)
+
+// csvfmt命令,把csv文件转换成规范的格式,规则见csv.CanonicalizeTable
+//
+//	csvfmt [-check] [-type name [-src file.go]] [-header 0] [-data 1] file...
+//
+// -check只检查不修改,输出不规范的文件名,有不规范的文件时返回1,可以用于git的pre-commit
+func FmtMain(args []string) int {
+	return fmtMain(args, os.Stdout, os.Stderr)
+}
+
+func fmtMain(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("csvfmt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags commonFlags
+	flags.register(fs)
+	flags.registerParse(fs)
+	check := fs.Bool("check", false, "只检查不修改,输出不规范的文件名")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: csvfmt [-check] [-type name [-src file.go]] [-header 0] [-data 1] file...")
+		fs.PrintDefaults()
+		return 2
+	}
+	typ, option, err := flags.typeAndOption(stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	exitCode := 0
+	for _, file := range fs.Args() {
+		changed, err := fmtFile(file, typ, option, !*check)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			exitCode = 1
+			continue
+		}
+		if changed && *check {
+			fmt.Fprintln(stdout, file)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// 返回文件是否需要修改
+func fmtFile(file string, typ reflect.Type, option *csv.CsvOption, write bool) (bool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	rows, err := csv.CanonicalizeCsvFile(file, typ, option)
+	if err != nil {
+		return false, err
+	}
+	var buf bytes.Buffer
+	if err = csv.WriteCsv(&buf, rows); err != nil {
+		return false, err
+	}
+	if bytes.Equal(data, buf.Bytes()) {
+		return false, nil
+	}
+	if write {
+		return true, os.WriteFile(file, buf.Bytes(), 0644)
+	}
+	return true, nil
+}
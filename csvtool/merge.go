@@ -0,0 +1,72 @@
+package csvtool
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fish-tennis/csv"
+)
+
+// csvmerge命令,三方合并csv文件,规则见csv.MergeTables,结果写入ours文件,可以用作git的merge driver
+//
+//	csvmerge [-o output] [-header 0] [-data 1] base.csv ours.csv theirs.csv
+//
+// 没有冲突时返回0,有冲突时返回1(冲突的单元格写入冲突标记,并输出到stderr),出错时返回2,ours文件不会被修改
+// base为空文件时(如git的add/add冲突,%O是空文件),当作没有数据行的表格,两边新增的同一行按单元格合并
+//
+// .git/config 或 ~/.gitconfig:
+//
+//	[merge "csv"]
+//		name = csv three-way merge
+//		driver = csvmerge %O %A %B
+//
+// .gitattributes:
+//
+//	*.csv merge=csv
+func MergeMain(args []string) int {
+	return mergeMain(args, os.Stderr)
+}
+
+func mergeMain(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("csvmerge", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags commonFlags
+	flags.register(fs)
+	output := fs.String("o", "", "输出的文件,默认写入ours文件")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 3 {
+		fmt.Fprintln(stderr, "usage: csvmerge [-o output] [-header 0] [-data 1] base.csv ours.csv theirs.csv")
+		fs.PrintDefaults()
+		return 2
+	}
+	_, option, err := flags.typeAndOption(stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	oursFile := fs.Arg(1)
+	rows, conflicts, err := csv.MergeCsvFiles(fs.Arg(0), oursFile, fs.Arg(2), option)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	outputFile := *output
+	if outputFile == "" {
+		outputFile = oursFile
+	}
+	if err = csv.WriteCsvFile(outputFile, rows); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if len(conflicts) == 0 {
+		return 0
+	}
+	for _, conflict := range conflicts {
+		fmt.Fprintf(stderr, "%v: conflict %v\n", oursFile, conflict)
+	}
+	return 1
+}
@@ -0,0 +1,167 @@
+package csvtool
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+)
+
+// Go源文件里的基础类型
+var basicTypes = map[string]reflect.Type{
+	"bool":    reflect.TypeOf(false),
+	"string":  reflect.TypeOf(""),
+	"int":     reflect.TypeOf(int(0)),
+	"int8":    reflect.TypeOf(int8(0)),
+	"int16":   reflect.TypeOf(int16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"uint":    reflect.TypeOf(uint(0)),
+	"uint8":   reflect.TypeOf(uint8(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"byte":    reflect.TypeOf(byte(0)),
+	"rune":    reflect.TypeOf(rune(0)),
+	"float32": reflect.TypeOf(float32(0)),
+	"float64": reflect.TypeOf(float64(0)),
+}
+
+// 根据Go源文件里的结构体,用reflect.StructOf生成对应的类型,用于没有注册类型的命令行
+//   - 支持基础类型,指针,数组,map,同一个文件里定义的结构体和类型(如type Color int32)
+//   - 其他包的类型,接口等无法生成的字段按字符串处理,单元格保持原样
+//   - 不导出的字段忽略,嵌入的字段作为普通字段,字段名是类型名
+//
+// 返回结构体的指针类型,如*ItemCfg
+func TypeFromSource(src, typeName string) (reflect.Type, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, src, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	b := &sourceTypeBuilder{
+		specs:    make(map[string]*ast.TypeSpec),
+		building: make(map[string]bool),
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok {
+			b.specs[spec.Name.Name] = spec
+		}
+		return true
+	})
+	spec, ok := b.specs[typeName]
+	if !ok {
+		return nil, fmt.Errorf("struct %v not found in %v", typeName, src)
+	}
+	if _, ok := spec.Type.(*ast.StructType); !ok {
+		return nil, fmt.Errorf("%v is not a struct in %v", typeName, src)
+	}
+	typ, err := b.build(ast.NewIdent(typeName))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", src, err)
+	}
+	return reflect.PointerTo(typ), nil
+}
+
+type sourceTypeBuilder struct {
+	specs map[string]*ast.TypeSpec
+	// 正在生成的类型,用于检查循环引用
+	building map[string]bool
+}
+
+func (b *sourceTypeBuilder) build(expr ast.Expr) (reflect.Type, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if typ, ok := basicTypes[e.Name]; ok {
+			return typ, nil
+		}
+		spec, ok := b.specs[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %v", e.Name)
+		}
+		if b.building[e.Name] {
+			return nil, fmt.Errorf("recursive type %v", e.Name)
+		}
+		b.building[e.Name] = true
+		defer delete(b.building, e.Name)
+		return b.build(spec.Type)
+	case *ast.ParenExpr:
+		return b.build(e.X)
+	case *ast.StarExpr:
+		typ, err := b.build(e.X)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.PointerTo(typ), nil
+	case *ast.ArrayType:
+		if e.Len != nil {
+			return nil, fmt.Errorf("unsupported array type")
+		}
+		typ, err := b.build(e.Elt)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(typ), nil
+	case *ast.MapType:
+		keyType, err := b.build(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		valueType, err := b.build(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(keyType, valueType), nil
+	case *ast.StructType:
+		return b.buildStruct(e)
+	}
+	return nil, fmt.Errorf("unsupported type %T", expr)
+}
+
+func (b *sourceTypeBuilder) buildStruct(structType *ast.StructType) (reflect.Type, error) {
+	var fields []reflect.StructField
+	for _, field := range structType.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			tagString, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(tagString)
+		}
+		names := field.Names
+		if len(names) == 0 {
+			// 嵌入的字段,字段名是类型名
+			names = []*ast.Ident{embeddedName(field.Type)}
+		}
+		fieldType, err := b.build(field.Type)
+		if err != nil {
+			// 无法生成的类型按字符串处理
+			fieldType = basicTypes["string"]
+		}
+		for _, name := range names {
+			if !name.IsExported() {
+				continue
+			}
+			fields = append(fields, reflect.StructField{Name: name.Name, Type: fieldType, Tag: tag})
+		}
+	}
+	return reflect.StructOf(fields), nil
+}
+
+// 如*pb.ItemCfg -> ItemCfg
+func embeddedName(expr ast.Expr) *ast.Ident {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.IndexExpr:
+		return embeddedName(e.X)
+	case *ast.Ident:
+		return e
+	}
+	return ast.NewIdent("")
+}
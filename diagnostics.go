@@ -0,0 +1,139 @@
+package csv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+)
+
+// 诊断信息的级别
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return strconv.Itoa(int(s))
+}
+
+// 加载过程中的诊断信息,如未知的列,列数不一致的行
+// 错误级别的诊断信息同时也会作为LoadError返回
+type Diagnostic struct {
+	Severity Severity
+	CellLocation
+	// 原因,可以用errors.Is判断,如ErrUnknownColumn
+	Err error
+}
+
+func (d Diagnostic) String() string {
+	location := d.CellLocation.String()
+	if location == "" {
+		return fmt.Sprintf("%v: %v", d.Severity, d.Err)
+	}
+	return fmt.Sprintf("%v: %v: %v", d.Severity, location, d.Err)
+}
+
+// 诊断信息的输出接口
+type Diagnostics interface {
+	Report(d Diagnostic)
+}
+
+// 不输出诊断信息
+var NopDiagnostics Diagnostics = nopDiagnostics{}
+
+type nopDiagnostics struct{}
+
+func (nopDiagnostics) Report(d Diagnostic) {}
+
+// CsvOption.Diagnostics为nil时使用,只输出警告,错误已经作为error返回,避免调用者处理错误时重复输出
+var defaultDiagnostics Diagnostics = &slogDiagnostics{skipErrors: true}
+
+// 输出到slog.Logger,logger为nil时使用slog.Default()
+func NewSlogDiagnostics(logger *slog.Logger) Diagnostics {
+	return &slogDiagnostics{logger: logger}
+}
+
+type slogDiagnostics struct {
+	logger *slog.Logger
+	// 不输出错误级别的诊断信息
+	skipErrors bool
+}
+
+func (s *slogDiagnostics) Report(d Diagnostic) {
+	if s.skipErrors && d.Severity >= SeverityError {
+		return
+	}
+	logger := s.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := slog.LevelInfo
+	switch d.Severity {
+	case SeverityWarning:
+		level = slog.LevelWarn
+	case SeverityError:
+		level = slog.LevelError
+	}
+	var attrs []slog.Attr
+	if d.File != "" {
+		attrs = append(attrs, slog.String("file", d.File))
+	}
+	if d.Row > 0 {
+		attrs = append(attrs, slog.Int("row", d.Row))
+	}
+	if d.ColumnLetter != "" {
+		attrs = append(attrs, slog.String("column", d.ColumnLetter), slog.String("value", d.Value))
+	}
+	if d.ColumnName != "" {
+		attrs = append(attrs, slog.String("columnName", d.ColumnName))
+	}
+	if d.FieldPath != "" {
+		attrs = append(attrs, slog.String("fieldPath", d.FieldPath))
+	}
+	logger.LogAttrs(context.Background(), level, fmt.Sprint(d.Err), attrs...)
+}
+
+// 收集诊断信息,如用于测试和工具显示
+type DiagnosticsCollector struct {
+	mu          sync.Mutex
+	diagnostics []Diagnostic
+}
+
+func (c *DiagnosticsCollector) Report(d Diagnostic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+// 收集到的诊断信息,severity<0时返回所有级别的
+func (c *DiagnosticsCollector) Diagnostics(severity Severity) []Diagnostic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var diagnostics []Diagnostic
+	for _, d := range c.diagnostics {
+		if severity < 0 || d.Severity == severity {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics
+}
+
+// 清空收集到的诊断信息
+func (c *DiagnosticsCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.diagnostics = nil
+}
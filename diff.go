@@ -0,0 +1,321 @@
+package csv
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// 一个字段的差异,值是格式化之后的字符串
+type FieldDiff struct {
+	// 列名
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// 一行的差异
+type RowDiff struct {
+	Key string `json:"key"`
+	// 新增的行只有New,删除的行只有Old,只包含不为空的字段
+	Fields []*FieldDiff `json:"fields,omitempty"`
+}
+
+// 两个版本的表格的差异,按key排序
+type TableDiff struct {
+	Added   []*RowDiff `json:"added,omitempty"`
+	Removed []*RowDiff `json:"removed,omitempty"`
+	Changed []*RowDiff `json:"changed,omitempty"`
+}
+
+func (d *TableDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// 输出文本格式的差异,每个修改的字段一行,如
+//
+//	Item 1001: Price 100 → 120
+//	Item 1002: added Name 普通物品2, Price 50
+//	Item 1003: removed
+func (d *TableDiff) WriteText(w io.Writer, tableName string) error {
+	prefix := ""
+	if tableName != "" {
+		prefix = tableName + " "
+	}
+	var lines []string
+	for _, row := range d.Added {
+		fields := make([]string, len(row.Fields))
+		for i, field := range row.Fields {
+			fields[i] = field.Field + " " + field.New
+		}
+		lines = append(lines, fmt.Sprintf("%v%v: added %v", prefix, row.Key, strings.Join(fields, ", ")))
+	}
+	for _, row := range d.Removed {
+		lines = append(lines, fmt.Sprintf("%v%v: removed", prefix, row.Key))
+	}
+	for _, row := range d.Changed {
+		for _, field := range row.Fields {
+			lines = append(lines, fmt.Sprintf("%v%v: %v %v → %v", prefix, row.Key, field.Field, field.Old, field.New))
+		}
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 比较两个版本的map表,字段的值使用注册的格式化接口转换成字符串
+// V支持proto.Message和普通struct结构
+func DiffTables[M ~map[K]V, K IntOrString, V any](oldTable, newTable M, option *CsvOption) (*TableDiff, error) {
+	lc := newLoadContext("", option)
+	elemType := rowElemType(reflect.TypeOf(oldTable).Elem())
+	columns := getWriteColumns(elemType, lc.option)
+	toSide := func(m M) *diffSide {
+		side := newDiffSide(columns)
+		keys := make([]K, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			key, _ := formatBasicValue(reflect.ValueOf(k))
+			side.addRow(key, lc.formatDiffRow(reflect.ValueOf(m[k]), -1, columns))
+		}
+		return side
+	}
+	oldSide, newSide := toSide(oldTable), toSide(newTable)
+	return diffSides(oldSide, newSide, nil), lc.errs.Err()
+}
+
+// 比较两个版本的csv数据,key列和ReadCsvFromDataMap一样,多个key列时key用,连接
+// typ是一行数据对应的类型,如*pb.ItemCfg,字段的值解析后再格式化成字符串比较,如007和7是一样的
+// typ为nil时,直接按列名比较单元格(去掉首尾空白)
+func DiffCsvData(oldRows, newRows [][]string, typ reflect.Type, option *CsvOption) (*TableDiff, error) {
+	return diffCsvData(newLoadContext("", option), newLoadContext("", option), oldRows, newRows, typ)
+}
+
+// 比较两个版本的csv文件,规则和DiffCsvData一样
+func DiffCsvFiles(oldFile, newFile string, typ reflect.Type, option *CsvOption) (*TableDiff, error) {
+	oldRows, err := ReadCsvFile(oldFile)
+	if err != nil {
+		return nil, err
+	}
+	newRows, err := ReadCsvFile(newFile)
+	if err != nil {
+		return nil, err
+	}
+	return diffCsvData(newLoadContext(oldFile, option), newLoadContext(newFile, option), oldRows, newRows, typ)
+}
+
+func diffCsvData(oldContext, newContext *loadContext, oldRows, newRows [][]string, typ reflect.Type) (*TableDiff, error) {
+	oldSide := oldContext.diffSideFromRows(oldRows, typ)
+	newSide := newContext.diffSideFromRows(newRows, typ)
+	errs := append(oldContext.errs, newContext.errs...)
+	if oldSide == nil || newSide == nil {
+		return nil, errs.Err()
+	}
+	var keyType reflect.Type
+	if typ != nil {
+		keyType = oldSide.keyType
+	}
+	return diffSides(oldSide, newSide, keyType), errs.Err()
+}
+
+// 一个版本的表格,每行的字段都格式化成字符串
+type diffSide struct {
+	// 字段(列)名,按顺序
+	fields []string
+	keys   []string
+	rows   map[string]map[string]string
+	// key列对应的字段类型
+	keyType reflect.Type
+}
+
+func newDiffSide(columns []*columnBinding) *diffSide {
+	side := &diffSide{
+		rows: make(map[string]map[string]string),
+	}
+	for _, column := range columns {
+		side.fields = append(side.fields, column.columnName)
+	}
+	return side
+}
+
+func (s *diffSide) addRow(key string, values []string) {
+	row := make(map[string]string, len(values))
+	for i, value := range values {
+		row[s.fields[i]] = value
+	}
+	s.keys = append(s.keys, key)
+	s.rows[key] = row
+}
+
+// 一行数据的字段格式化成字符串,格式化失败时使用fmt.Sprint
+func (lc *loadContext) formatDiffRow(object reflect.Value, rowIndex int, columns []*columnBinding) []string {
+	values := make([]string, len(columns))
+	object = reflect.Indirect(object)
+	if !object.IsValid() {
+		return values
+	}
+	for i, column := range columns {
+		value, err := lc.formatCell(object, column, false)
+		if err != nil {
+			lc.warn(cellLocation(rowIndex, column.columnIndex, column.columnName, ""), err)
+			value = fmt.Sprint(object.FieldByIndex(column.fieldIndex).Interface())
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// 解析csv数据,key重复时返回错误
+func (lc *loadContext) diffSideFromRows(rows [][]string, typ reflect.Type) *diffSide {
+	option := lc.option
+	if len(rows) == 0 {
+		lc.fail(ErrNoCsvHeader)
+		return nil
+	}
+	if len(rows) <= option.ColumnNameRowIndex {
+		lc.fail(ErrNoColumnNameHeader)
+		return nil
+	}
+	if option.DataBeginRowIndex < 1 {
+		lc.fail(ErrDataBeginRowIndex)
+		return nil
+	}
+	columnNames := rows[option.ColumnNameRowIndex]
+	var side *diffSide
+	var elemType reflect.Type
+	var bindings, columns []*columnBinding
+	if typ != nil {
+		var ok bool
+		elemType = rowElemType(typ)
+		bindings, ok = lc.bindColumns(elemType, option.ColumnNameRowIndex, columnNames)
+		if !ok {
+			return nil
+		}
+		columns = getWriteColumns(elemType, option)
+	} else {
+		for columnIndex, name := range columnNames {
+			if name = strings.TrimSpace(name); name != "" {
+				columns = append(columns, &columnBinding{columnIndex: columnIndex, columnName: name})
+			}
+		}
+	}
+	keyIndexes, ok := lc.keyColumnIndexes(elemType, option.ColumnNameRowIndex, columnNames, bindings)
+	if !ok {
+		return nil
+	}
+	// key列对应的字段,没有对应的字段时为nil
+	keyBindings := make([]*columnBinding, len(keyIndexes))
+	for i, keyIndex := range keyIndexes {
+		for _, binding := range bindings {
+			if binding.columnIndex == keyIndex {
+				keyBindings[i] = binding
+			}
+		}
+	}
+	side = newDiffSide(columns)
+	if len(keyBindings) == 1 && keyBindings[0] != nil {
+		side.keyType = elemType.FieldByIndex(keyBindings[0].fieldIndex).Type
+	}
+	keyRows := make(map[string]int)
+	for rowIndex := option.DataBeginRowIndex; rowIndex < len(rows) && !lc.stopped; rowIndex++ {
+		row := lc.normalizeRow(rowIndex, rows[rowIndex], len(columnNames))
+		if row == nil {
+			continue
+		}
+		keyRow := row
+		var values []string
+		if typ != nil {
+			object := lc.convertRow(typ, rowIndex, row, bindings)
+			// key也按字段的格式,如007和7是同一个key
+			keyRow = slices.Clone(row)
+			for i, keyBinding := range keyBindings {
+				if keyBinding == nil {
+					continue
+				}
+				if formattedKey, err := lc.formatCell(reflect.Indirect(object), keyBinding, true); err == nil {
+					keyRow[keyIndexes[i]] = formattedKey
+				}
+			}
+			values = lc.formatDiffRow(object, rowIndex, columns)
+		} else {
+			values = make([]string, len(columns))
+			for i, column := range columns {
+				values[i] = strings.TrimSpace(row[column.columnIndex])
+			}
+		}
+		key := rowKeyString(keyRow, keyIndexes)
+		if firstRowIndex, ok := keyRows[key]; ok {
+			keyIndex := keyIndexes[0]
+			lc.addCellError(&DuplicateKeyError{Key: key, FirstRow: firstRowIndex + 1}, rowIndex, keyIndex, strings.TrimSpace(columnNames[keyIndex]), row[keyIndex], "")
+			continue
+		}
+		keyRows[key] = rowIndex
+		side.addRow(key, values)
+	}
+	return side
+}
+
+// keyType不为nil时,按keyType排序,否则key都是数字时按数值排序
+func diffSides(oldSide, newSide *diffSide, keyType reflect.Type) *TableDiff {
+	diff := &TableDiff{}
+	fields := slices.Clone(newSide.fields)
+	for _, field := range oldSide.fields {
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	for _, key := range newSide.keys {
+		newRow := newSide.rows[key]
+		oldRow, ok := oldSide.rows[key]
+		if !ok {
+			rowDiff := &RowDiff{Key: key}
+			for _, field := range newSide.fields {
+				if newRow[field] != "" {
+					rowDiff.Fields = append(rowDiff.Fields, &FieldDiff{Field: field, New: newRow[field]})
+				}
+			}
+			diff.Added = append(diff.Added, rowDiff)
+			continue
+		}
+		rowDiff := &RowDiff{Key: key}
+		for _, field := range fields {
+			if oldRow[field] != newRow[field] {
+				rowDiff.Fields = append(rowDiff.Fields, &FieldDiff{Field: field, Old: oldRow[field], New: newRow[field]})
+			}
+		}
+		if len(rowDiff.Fields) > 0 {
+			diff.Changed = append(diff.Changed, rowDiff)
+		}
+	}
+	for _, key := range oldSide.keys {
+		if _, ok := newSide.rows[key]; ok {
+			continue
+		}
+		oldRow := oldSide.rows[key]
+		rowDiff := &RowDiff{Key: key}
+		for _, field := range oldSide.fields {
+			if oldRow[field] != "" {
+				rowDiff.Fields = append(rowDiff.Fields, &FieldDiff{Field: field, Old: oldRow[field]})
+			}
+		}
+		diff.Removed = append(diff.Removed, rowDiff)
+	}
+	for _, rowDiffs := range [][]*RowDiff{diff.Added, diff.Removed, diff.Changed} {
+		keys := make([]string, len(rowDiffs))
+		for i, rowDiff := range rowDiffs {
+			keys[i] = rowDiff.Key
+		}
+		compare := keyStringComparer(keys, keyType)
+		slices.SortStableFunc(rowDiffs, func(a, b *RowDiff) int {
+			return compare(a.Key, b.Key)
+		})
+	}
+	return diff
+}
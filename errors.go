@@ -0,0 +1,316 @@
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 固定的错误,可以用errors.Is判断
+var (
+	ErrNoCsvHeader             = errors.New("no csv header")
+	ErrNoColumnNameHeader      = errors.New("no column name header")
+	ErrNoColumn                = errors.New("no column")
+	ErrDataBeginRowIndex       = errors.New("DataBeginRowIndex must >=1")
+	ErrObjectColumnCount       = errors.New("column count must >= 2")
+	ErrObjectDataBeginRowIndex = errors.New("ObjectDataBeginRowIndex must >=1")
+	ErrObjectNotPtr            = errors.New("v must be Ptr")
+	ErrUnknownColumn           = errors.New("unknown column")
+	ErrFieldCantSet            = errors.New("field cant set")
+	ErrUnknownField            = errors.New("unknown field")
+	ErrInvalidBool             = errors.New("invalid bool")
+	ErrUnsupportedKind         = errors.New("unsupported kind")
+	ErrSliceElem               = errors.New("slice item parse error")
+	ErrMapKey                  = errors.New("map key parse error")
+	ErrMapValue                = errors.New("map value parse error")
+	ErrDuplicateKey            = errors.New("duplicate key")
+	ErrRaggedRow               = errors.New("column count mismatch")
+	ErrConvertedType           = errors.New("converted value type mismatch")
+	ErrMissingColumn           = errors.New("missing required column")
+	ErrEmptyCell               = errors.New("empty cell")
+	ErrPanic                   = errors.New("panic")
+	ErrTooManyErrors           = errors.New("too many errors")
+	ErrSeparatorInValue        = errors.New("value contains separator")
+	ErrNoFormatter             = errors.New("converter has no formatter")
+	ErrCanonicalize            = errors.New("cell can't be canonicalized")
+	ErrKeyColumn               = errors.New("key columns don't match map key")
+	ErrSyntax                  = errors.New("cell syntax error")
+)
+
+// 单元格的位置
+type CellLocation struct {
+	// 文件名,直接解析[][]string时为空
+	File string
+	// 行号,从1开始,和Excel显示的行号一致,0表示和行无关
+	Row int
+	// 列索引,从0开始,ColumnLetter为空时表示和列无关
+	Column int
+	// Excel风格的列号,如A,B,AA
+	ColumnLetter string
+	// 列名
+	ColumnName string
+	// 单元格的原始字符串
+	Value string
+	// 对应的字段路径,如Args.CfgId,Items[1].Num
+	FieldPath string
+}
+
+// 如 item.csv row 3 column B(Rate) field Rate value "abc"
+func (l *CellLocation) String() string {
+	var parts []string
+	if l.File != "" {
+		parts = append(parts, l.File)
+	}
+	if l.Row > 0 {
+		parts = append(parts, fmt.Sprintf("row %v", l.Row))
+	}
+	if l.ColumnLetter != "" {
+		parts = append(parts, fmt.Sprintf("column %v(%v)", l.ColumnLetter, l.ColumnName))
+	} else if l.ColumnName != "" {
+		parts = append(parts, fmt.Sprintf("column %v", l.ColumnName))
+	}
+	if l.FieldPath != "" {
+		parts = append(parts, fmt.Sprintf("field %v", l.FieldPath))
+	}
+	if l.ColumnLetter != "" {
+		parts = append(parts, fmt.Sprintf("value %q", l.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// 加载csv数据时的错误,带有出错的单元格位置
+type LoadError struct {
+	CellLocation
+	// 错误原因
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	location := e.CellLocation.String()
+	if location == "" {
+		return fmt.Sprint(e.Err)
+	}
+	return fmt.Sprintf("%v: %v", location, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// map表中重复的key
+type DuplicateKeyError struct {
+	// key的原始字符串
+	Key string
+	// key第一次出现的行号,从1开始
+	FirstRow int
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %v, first defined at row %v", e.Key, e.FirstRow)
+}
+
+func (e *DuplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+// 单元格的语法错误,如{}不匹配
+type SyntaxError struct {
+	// 出错的位置在单元格中的字符偏移,从0开始
+	Offset int
+	// 错误原因
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %v: %v", e.Offset, e.Msg)
+}
+
+func (e *SyntaxError) Is(target error) bool {
+	return target == ErrSyntax
+}
+
+// 转换单元格时发生的panic,如自定义转换接口的bug
+type PanicError struct {
+	// recover()的返回值
+	Value any
+	// 发生panic时的调用栈
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+func (e *PanicError) Is(target error) bool {
+	return target == ErrPanic
+}
+
+// 一次加载过程中的所有错误
+type LoadErrors []*LoadError
+
+func (es LoadErrors) Error() string {
+	if len(es) == 1 {
+		return es[0].Error()
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v errors:", len(es))
+	for _, e := range es {
+		sb.WriteString("\n\t")
+		sb.WriteString(e.Error())
+	}
+	return sb.String()
+}
+
+// 支持errors.Is和errors.As
+func (es LoadErrors) Unwrap() []error {
+	errs := make([]error, len(es))
+	for i, e := range es {
+		errs[i] = e
+	}
+	return errs
+}
+
+// 没有错误时返回nil,避免返回有类型的nil
+func (es LoadErrors) Err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
+
+// 列索引转换成Excel风格的列号,如0->A,25->Z,26->AA
+func ColumnLetter(columnIndex int) string {
+	if columnIndex < 0 {
+		return ""
+	}
+	var letters []byte
+	for n := columnIndex + 1; n > 0; n = (n - 1) / 26 {
+		letters = append(letters, byte('A'+(n-1)%26))
+	}
+	for i, j := 0, len(letters)-1; i < j; i, j = i+1, j-1 {
+		letters[i], letters[j] = letters[j], letters[i]
+	}
+	return string(letters)
+}
+
+// 把err展开成LoadErrors
+func toLoadErrors(err error) LoadErrors {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case LoadErrors:
+		return e
+	case *LoadError:
+		return LoadErrors{e}
+	default:
+		return LoadErrors{{Err: err}}
+	}
+}
+
+// 给错误加上字段路径前缀,如Args + CfgId -> Args.CfgId
+func wrapFieldError(err error, fieldName string) error {
+	if err == nil {
+		return nil
+	}
+	errs := toLoadErrors(err)
+	for _, e := range errs {
+		e.FieldPath = joinFieldPath(fieldName, e.FieldPath)
+	}
+	return errs
+}
+
+func joinFieldPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	if child == "" {
+		return parent
+	}
+	if strings.HasPrefix(child, "[") {
+		return parent + child
+	}
+	return parent + "." + child
+}
+
+// 一次加载过程的上下文
+type loadContext struct {
+	file   string
+	option *CsvOption
+	errs   LoadErrors
+	// 错误数量超过限制,停止加载
+	stopped bool
+}
+
+func newLoadContext(file string, option *CsvOption) *loadContext {
+	if option == nil {
+		option = &DefaultOption
+	}
+	return &loadContext{
+		file:   file,
+		option: option,
+	}
+}
+
+// 和单元格无关的错误,如缺少表头
+func (lc *loadContext) fail(err error) error {
+	lc.addError(&LoadError{Err: err})
+	return lc.errs
+}
+
+func (lc *loadContext) addError(e *LoadError) {
+	if lc.stopped {
+		return
+	}
+	e.File = lc.file
+	lc.errs = append(lc.errs, e)
+	lc.report(SeverityError, e.CellLocation, e.Err)
+	switch lc.option.ErrorPolicy {
+	case ErrorPolicyStopOnFirst:
+		lc.stopped = true
+	case ErrorPolicyMaxErrors:
+		if lc.option.MaxErrors > 0 && len(lc.errs) >= lc.option.MaxErrors {
+			lc.stopped = true
+			tooMany := &LoadError{
+				CellLocation: CellLocation{File: lc.file},
+				Err:          fmt.Errorf("%w: stopped after %v errors", ErrTooManyErrors, len(lc.errs)),
+			}
+			lc.errs = append(lc.errs, tooMany)
+			lc.report(SeverityError, tooMany.CellLocation, tooMany.Err)
+		}
+	}
+}
+
+// 记录单元格的错误,rowIndex和columnIndex是从0开始的索引
+func (lc *loadContext) addCellError(err error, rowIndex, columnIndex int, columnName, value, fieldName string) {
+	for _, e := range toLoadErrors(err) {
+		fieldPath := joinFieldPath(fieldName, e.FieldPath)
+		e.CellLocation = cellLocation(rowIndex, columnIndex, columnName, value)
+		e.FieldPath = fieldPath
+		lc.addError(e)
+	}
+}
+
+// 警告不会作为错误返回,只输出到CsvOption.Diagnostics
+func (lc *loadContext) warn(location CellLocation, err error) {
+	location.File = lc.file
+	lc.report(SeverityWarning, location, err)
+}
+
+func (lc *loadContext) report(severity Severity, location CellLocation, err error) {
+	lc.option.diagnostics().Report(Diagnostic{
+		Severity:     severity,
+		CellLocation: location,
+		Err:          err,
+	})
+}
+
+// rowIndex和columnIndex是从0开始的索引,columnIndex<0表示和列无关
+func cellLocation(rowIndex, columnIndex int, columnName, value string) CellLocation {
+	return CellLocation{
+		Row:          rowIndex + 1,
+		Column:       columnIndex,
+		ColumnLetter: ColumnLetter(columnIndex),
+		ColumnName:   columnName,
+		Value:        value,
+	}
+}
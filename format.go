@@ -0,0 +1,362 @@
+package csv
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 字段的值转换成字符串,是ConvertStringToFieldValue的逆过程
+// 数组使用SliceSeparator,子结构和map使用KvSeparator和PairSeparator,如CfgId_1#Num_2;CfgId_2#Num_3
+// 子结构,数组和map可以嵌套任意层,包含外层的分隔符时用{}括起来,如Name_a#Items_{CfgId_1#Num_1;CfgId_2#Num_1}
+// nil和零值转换成空字符串
+// 数组,map,子结构里的值包含分隔符,{}或者转义字符时,加上转义字符(CsvOption.EscapeChar),如Name_Fire\#Sword
+// 没有设置转义字符,或者注册的格式化接口返回的值包含分隔符,导致无法再解析回来时,返回ErrSeparatorInValue
+func ConvertFieldValueToString(fieldVal reflect.Value, columnName string, option *CsvOption) (string, error) {
+	if option == nil {
+		option = &DefaultOption
+	}
+	return formatFieldValue(fieldVal, columnName, option, false)
+}
+
+// keepZero为true时,零值也会写入,如有默认值的字段,空单元格会被读取成默认值
+func formatFieldValue(fieldVal reflect.Value, columnName string, option *CsvOption, keepZero bool) (string, error) {
+	if !fieldVal.IsValid() {
+		return "", nil
+	}
+	if fieldVal.Kind() == reflect.Ptr {
+		if fieldVal.IsNil() {
+			return "", nil
+		}
+		fieldVal = fieldVal.Elem()
+	}
+	if !keepZero && fieldVal.IsZero() {
+		return "", nil
+	}
+	f := &valueFormatter{columnName: columnName, option: option}
+	// 列名注册的格式化接口优先,然后是类型注册的格式化接口
+	if formatter := option.GetFormatterByColumnName(columnName); formatter != nil {
+		return f.callFormatter(formatter, fieldVal, false, nil)
+	}
+	if s, ok, err := f.formatByType(fieldVal, nil); ok {
+		return s, err
+	}
+	return f.format(fieldVal)
+}
+
+type valueFormatter struct {
+	columnName string
+	option     *CsvOption
+}
+
+// 使用类型注册的格式化接口,没有注册时返回false
+func (f *valueFormatter) formatByType(v reflect.Value, forbidden []string) (string, bool, error) {
+	formatter, formatPtr := f.option.getFormatterByTypePtrOrElem(v.Type())
+	if formatter == nil {
+		return "", false, nil
+	}
+	s, err := f.callFormatter(formatter, v, formatPtr, forbidden)
+	return s, true, err
+}
+
+func (f *valueFormatter) callFormatter(formatter FieldFormatter, v reflect.Value, formatPtr bool, forbidden []string) (string, error) {
+	if formatPtr {
+		// 注册的是指针类型
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+	s, err := formatter(FormatContext{
+		ColumnName: f.columnName,
+		FieldValue: v.Interface(),
+		FieldType:  v.Type(),
+		Option:     f.option,
+	})
+	if err != nil {
+		return "", err
+	}
+	return s, checkSeparator(s, forbidden)
+}
+
+func (f *valueFormatter) format(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.Struct:
+		return f.formatStruct(v)
+
+	case reflect.Slice:
+		// 和读取时一样,字段是[]byte时,也是数字的数组,如1;2;3
+		return f.formatSlice(v)
+
+	case reflect.Map:
+		return f.formatMap(v)
+	}
+	return formatBasic(v, nil)
+}
+
+// 数组的元素和map的value是[]byte时,和读取时一样,视为字符串
+// forbidden是当前位置不能出现的分隔符,如数组元素里不能有SliceSeparator
+func formatBasic(v reflect.Value, forbidden []string) (string, error) {
+	s, err := formatBasicValue(v)
+	if err != nil {
+		return "", err
+	}
+	return s, checkSeparator(s, forbidden)
+}
+
+// 子结构的字段,数组的元素,map的value
+// 子结构,数组和map包含当前层的分隔符时,用{}括起来,基础类型转义当前层的分隔符和{}
+func (f *valueFormatter) formatNested(v reflect.Value, composite bool, separators []string) (string, error) {
+	if !composite {
+		s, err := formatBasicValue(v)
+		if err != nil {
+			return "", err
+		}
+		return escapeValue(s, f.option.EscapeChar, separators)
+	}
+	s, err := f.format(v)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(s, "{") || hasOuterSeparator(s, f.option.EscapeChar, separators) {
+		s = "{" + s + "}"
+	}
+	return s, nil
+}
+
+// {}外是否有分隔符,{}里的分隔符不影响解析
+func hasOuterSeparator(s, escape string, separators []string) bool {
+	for _, separator := range separators {
+		if indexes, err := newCellSegment(s, escape).separatorIndexes(separator, 1); err != nil || len(indexes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 如CfgId_1#Num_2,零值的字段不写入
+// 和读取时一样,子结构的字段不使用注册的格式化接口
+func (f *valueFormatter) formatStruct(v reflect.Value) (string, error) {
+	typ := v.Type()
+	keyForbidden := []string{f.option.PairSeparator, f.option.KvSeparator, "{", "}"}
+	valueSeparators := []string{f.option.PairSeparator}
+	var pairs []string
+	var errs LoadErrors
+	firstField := -1
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if tag := parseCsvTag(field.Tag); !field.IsExported() || tag.Skip || tag.Ignore {
+			continue
+		}
+		if firstField < 0 {
+			firstField = i
+		}
+		fieldVal := v.Field(i)
+		if fieldVal.Kind() == reflect.Ptr {
+			if fieldVal.IsNil() {
+				continue
+			}
+			fieldVal = fieldVal.Elem()
+		} else if fieldVal.IsZero() {
+			continue
+		}
+		value, err := f.subField(field).formatNested(fieldVal, isCompositeKind(fieldVal.Kind()), valueSeparators)
+		if err == nil {
+			err = checkSeparator(field.Name, keyForbidden)
+		}
+		if err != nil {
+			errs = append(errs, toLoadErrors(wrapFieldError(err, field.Name))...)
+			continue
+		}
+		pairs = append(pairs, field.Name+f.option.KvSeparator+value)
+	}
+	if len(pairs) == 0 && len(errs) == 0 && firstField >= 0 {
+		// 所有字段都是零值,写入第一个字段,避免数组里出现空元素
+		field := typ.Field(firstField)
+		zero := reflect.Zero(rowElemType(field.Type))
+		value, err := f.subField(field).formatNested(zero, isCompositeKind(zero.Kind()), valueSeparators)
+		if err == nil {
+			err = checkSeparator(field.Name, keyForbidden)
+		}
+		if err != nil {
+			return "", wrapFieldError(err, field.Name)
+		}
+		pairs = append(pairs, field.Name+f.option.KvSeparator+value)
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return strings.Join(pairs, f.option.PairSeparator), nil
+}
+
+// 子结构的字段使用的formatter,和读取时一样,字段的tag里可以设置分隔符
+func (f *valueFormatter) subField(field reflect.StructField) *valueFormatter {
+	option := structFieldOption(field, f.option)
+	if option == f.option {
+		return f
+	}
+	return &valueFormatter{columnName: f.columnName, option: option}
+}
+
+// 如1;2;3,空元素读取时会被跳过,所以基础类型的空元素返回错误
+func (f *valueFormatter) formatSlice(v reflect.Value) (string, error) {
+	elemSeparators := []string{f.option.SliceSeparator}
+	elems := make([]string, 0, v.Len())
+	var errs LoadErrors
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		path := fmt.Sprintf("[%v]", i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				errs = append(errs, toLoadErrors(wrapFieldError(fmt.Errorf("%w: nil", ErrSliceElem), path))...)
+				continue
+			}
+			elem = elem.Elem()
+		}
+		s, ok, err := f.formatByType(elem, elemSeparators)
+		if !ok {
+			s, err = f.formatNested(elem, isCompositeValue(elem), elemSeparators)
+		}
+		if err == nil && s == "" {
+			if isCompositeValue(elem) {
+				// 空的数组和map元素写成{}
+				s = "{}"
+			} else {
+				err = fmt.Errorf("%w: empty", ErrSliceElem)
+			}
+		}
+		if err != nil {
+			errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
+			continue
+		}
+		elems = append(elems, s)
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return strings.Join(elems, f.option.SliceSeparator), nil
+}
+
+// 如a_1#b_2,按key排序
+func (f *valueFormatter) formatMap(v reflect.Value) (string, error) {
+	keySeparators := []string{f.option.PairSeparator, f.option.KvSeparator}
+	valueSeparators := []string{f.option.PairSeparator}
+	keys := v.MapKeys()
+	slices.SortFunc(keys, compareMapKey)
+	pairs := make([]string, 0, len(keys))
+	var errs LoadErrors
+	for _, key := range keys {
+		keyString, err := formatBasicValue(key)
+		if err != nil {
+			errs = append(errs, toLoadErrors(fmt.Errorf("%w: %w", ErrMapKey, err))...)
+			continue
+		}
+		path := fmt.Sprintf("[%v]", keyString)
+		if keyString, err = escapeValue(keyString, f.option.EscapeChar, keySeparators); err != nil {
+			errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
+			continue
+		}
+		value := v.MapIndex(key)
+		if value.Kind() == reflect.Ptr && !value.IsNil() {
+			value = value.Elem()
+		}
+		valueString, ok, err := f.formatByType(value, valueSeparators)
+		if !ok {
+			valueString, err = f.formatNested(value, isCompositeValue(value), valueSeparators)
+		}
+		if err != nil {
+			errs = append(errs, toLoadErrors(wrapFieldError(err, path))...)
+			continue
+		}
+		pairs = append(pairs, keyString+f.option.KvSeparator+valueString)
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return strings.Join(pairs, f.option.PairSeparator), nil
+}
+
+// 子结构的字段是[]byte时,和读取时一样,也是数字的数组
+func isCompositeKind(kind reflect.Kind) bool {
+	return kind == reflect.Struct || kind == reflect.Slice || kind == reflect.Map
+}
+
+// 结构体,map,数组([]byte除外)
+func isCompositeValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	case reflect.Slice:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+func compareMapKey(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float(), b.Float())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	}
+	return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+}
+
+func compareOrdered[T int64 | uint64 | float64](a, b T) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func appendSeparators(forbidden []string, separators ...string) []string {
+	return append(slices.Clip(forbidden), separators...)
+}
+
+// 值里包含分隔符时,读取时会被错误的分割
+func checkSeparator(s string, forbidden []string) error {
+	for _, separator := range forbidden {
+		if separator != "" && strings.Contains(s, separator) {
+			return fmt.Errorf("%w: %q contains %q", ErrSeparatorInValue, s, separator)
+		}
+	}
+	return nil
+}
+
+// 基础类型转换成字符串,nil指针转换成空字符串
+func formatBasicValue(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Slice:
+		// []byte
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %v", ErrUnsupportedKind, v.Type())
+}
@@ -0,0 +1,239 @@
+package csv
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// map的一层key对应的列
+type keyBinding struct {
+	keyType reflect.Type
+	// key是基础类型时只有一列,fieldIndex为nil
+	// key是结构体时,每个字段对应一列,按列名查找结构体的字段
+	columns []*columnBinding
+}
+
+// map的每一层key的类型,以及一行数据对应的类型
+// 如map[int32]map[int32]*pb.SkillLevelCfg -> [int32 int32], *pb.SkillLevelCfg
+func mapKeyTypes(mType reflect.Type) ([]reflect.Type, reflect.Type) {
+	var keyTypes []reflect.Type
+	for mType.Kind() == reflect.Map {
+		keyTypes = append(keyTypes, mType.Key())
+		mType = mType.Elem()
+	}
+	return keyTypes, mType
+}
+
+// 是否配置了key列(CsvOption.KeyColumnNames或者csv:",key"),没有配置时固定第一列是key
+func hasKeyColumns(elemType reflect.Type, option *CsvOption) bool {
+	if len(option.KeyColumnNames) > 0 {
+		return true
+	}
+	for i := 0; i < elemType.NumField(); i++ {
+		if parseCsvTag(elemType.Field(i).Tag).Key {
+			return true
+		}
+	}
+	return false
+}
+
+// key列的索引
+// 优先级: CsvOption.KeyColumnNames > csv:",key"的字段(按字段的声明顺序) > 第一列
+// elemType为nil时不检查csv:",key"的字段
+func (lc *loadContext) keyColumnIndexes(elemType reflect.Type, headerRowIndex int, columnNames []string, bindings []*columnBinding) ([]int, bool) {
+	option := lc.option
+	var indexes []int
+	if len(option.KeyColumnNames) > 0 {
+		for _, keyColumnName := range option.KeyColumnNames {
+			index := slices.IndexFunc(columnNames, func(name string) bool {
+				return strings.TrimSpace(name) == keyColumnName
+			})
+			if index < 0 {
+				lc.addError(&LoadError{
+					CellLocation: CellLocation{Row: headerRowIndex + 1, ColumnName: keyColumnName},
+					Err:          ErrMissingColumn,
+				})
+				return nil, false
+			}
+			indexes = append(indexes, index)
+		}
+		return indexes, true
+	}
+	for i := 0; elemType != nil && i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if !parseCsvTag(field.Tag).Key {
+			continue
+		}
+		index := slices.IndexFunc(bindings, func(binding *columnBinding) bool {
+			return binding.fieldName == field.Name
+		})
+		if index < 0 {
+			lc.addError(&LoadError{
+				CellLocation: CellLocation{Row: headerRowIndex + 1, ColumnName: columnNameOfField(field, option), FieldPath: field.Name},
+				Err:          ErrMissingColumn,
+			})
+			return nil, false
+		}
+		indexes = append(indexes, bindings[index].columnIndex)
+	}
+	if len(indexes) == 0 {
+		// 固定第一列是key
+		indexes = append(indexes, 0)
+	}
+	return indexes, true
+}
+
+// key列和map的每一层key对应起来
+// 基础类型的key对应一列,结构体的key的每个导出字段对应一列
+func (lc *loadContext) bindKeyColumns(elemType reflect.Type, keyTypes []reflect.Type, headerRowIndex int, columnNames []string, bindings []*columnBinding) ([]*keyBinding, bool) {
+	indexes, ok := lc.keyColumnIndexes(elemType, headerRowIndex, columnNames, bindings)
+	if !ok {
+		return nil, false
+	}
+	keyError := func(err error) ([]*keyBinding, bool) {
+		lc.addError(&LoadError{
+			CellLocation: CellLocation{Row: headerRowIndex + 1},
+			Err:          err,
+		})
+		return nil, false
+	}
+	var keyBindings []*keyBinding
+	next := 0
+	for _, keyType := range keyTypes {
+		keyBinding := &keyBinding{keyType: keyType}
+		if keyType.Kind() != reflect.Struct {
+			if next >= len(indexes) {
+				return keyError(fmt.Errorf("%w: %v key columns, map key %v", ErrKeyColumn, len(indexes), keyTypes))
+			}
+			columnIndex := indexes[next]
+			keyBinding.columns = append(keyBinding.columns, &columnBinding{
+				columnIndex: columnIndex,
+				columnName:  strings.TrimSpace(columnNames[columnIndex]),
+			})
+			next++
+			keyBindings = append(keyBindings, keyBinding)
+			continue
+		}
+		// 结构体的key,按列名查找字段
+		resolver := newFieldResolver(keyType, lc.option)
+		fieldCount := 0
+		for i := 0; i < keyType.NumField(); i++ {
+			if keyType.Field(i).IsExported() {
+				fieldCount++
+			}
+		}
+		if next+fieldCount > len(indexes) {
+			return keyError(fmt.Errorf("%w: %v key columns, map key %v", ErrKeyColumn, len(indexes), keyTypes))
+		}
+		for _, columnIndex := range indexes[next : next+fieldCount] {
+			columnName := strings.TrimSpace(columnNames[columnIndex])
+			binding, ok := resolver.binding(columnIndex, columnName)
+			if !ok {
+				return keyError(fmt.Errorf("%w: key column %v has no field in %v", ErrKeyColumn, columnName, keyType))
+			}
+			keyBinding.columns = append(keyBinding.columns, binding)
+		}
+		next += fieldCount
+		keyBindings = append(keyBindings, keyBinding)
+	}
+	if next != len(indexes) {
+		return keyError(fmt.Errorf("%w: %v key columns, map key %v", ErrKeyColumn, len(indexes), keyTypes))
+	}
+	return keyBindings, true
+}
+
+// 一行数据的每一层key,出错时返回false
+func (lc *loadContext) convertKeys(rowIndex int, row []string, keyBindings []*keyBinding) ([]reflect.Value, bool) {
+	keyVals := make([]reflect.Value, 0, len(keyBindings))
+	ok := true
+	for _, keyBinding := range keyBindings {
+		if keyBinding.keyType.Kind() != reflect.Struct {
+			column := keyBinding.columns[0]
+			key, err := convertStringToRealType(keyBinding.keyType, row[column.columnIndex], lc.option.Strict)
+			if err != nil {
+				lc.addCellError(err, rowIndex, column.columnIndex, column.columnName, row[column.columnIndex], "")
+				ok = false
+				continue
+			}
+			keyVals = append(keyVals, reflect.ValueOf(key))
+			continue
+		}
+		keyVal := reflect.New(keyBinding.keyType)
+		for _, column := range keyBinding.columns {
+			// 和其他列一样转换,自定义转换接口的panic会被转换成错误
+			errCount := len(lc.errs)
+			lc.convertCell(keyVal, keyVal.Elem(), column, rowIndex, row[column.columnIndex], false)
+			if len(lc.errs) > errCount {
+				ok = false
+			}
+		}
+		keyVals = append(keyVals, keyVal.Elem())
+	}
+	return keyVals, ok
+}
+
+// key列的原始字符串,用于重复key的错误信息
+func keyString(row []string, keyBindings []*keyBinding) string {
+	var cells []string
+	for _, keyBinding := range keyBindings {
+		for _, column := range keyBinding.columns {
+			cells = append(cells, row[column.columnIndex])
+		}
+	}
+	return strings.Join(cells, ",")
+}
+
+// key列的字符串,去掉首尾空白,多个key列用,连接,用于没有绑定map的key的合并,比较等
+func rowKeyString(row []string, indexes []int) string {
+	cells := make([]string, len(indexes))
+	for i, index := range indexes {
+		if index < len(row) {
+			cells[i] = strings.TrimSpace(row[index])
+		}
+	}
+	return strings.Join(cells, ",")
+}
+
+// 嵌套的map中最后一层的map,中间层的map不存在时创建
+func innerMap(mVal reflect.Value, keyVals []reflect.Value) reflect.Value {
+	for _, keyVal := range keyVals[:len(keyVals)-1] {
+		inner := mVal.MapIndex(keyVal)
+		if !inner.IsValid() || inner.IsNil() {
+			inner = reflect.MakeMap(mVal.Type().Elem())
+			mVal.SetMapIndex(keyVal, inner)
+		}
+		mVal = inner
+	}
+	return mVal
+}
+
+// 嵌套的map展开成一行行的数据,按key排序
+func flattenMap(mVal reflect.Value) []reflect.Value {
+	keys := mVal.MapKeys()
+	slices.SortFunc(keys, compareKey)
+	var values []reflect.Value
+	for _, key := range keys {
+		value := mVal.MapIndex(key)
+		if value.Kind() == reflect.Map {
+			values = append(values, flattenMap(value)...)
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// 结构体的key按字段依次比较
+func compareKey(a, b reflect.Value) int {
+	if a.Kind() != reflect.Struct {
+		return compareMapKey(a, b)
+	}
+	for i := 0; i < a.NumField(); i++ {
+		if c := compareKey(a.Field(i), b.Field(i)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
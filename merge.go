@@ -0,0 +1,316 @@
+package csv
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// 合并时的冲突
+type MergeConflict struct {
+	// 行的key,表头和数据行之间的行为空
+	Key string
+	// 冲突的行在合并结果中的行号,从1开始
+	Row int
+	// 列名,整行冲突(一边删除了行,另一边修改了行)时为空
+	ColumnName string
+	Base       string
+	Ours       string
+	Theirs     string
+}
+
+func (c *MergeConflict) Error() string {
+	if c.ColumnName == "" {
+		return fmt.Sprintf("row %v key %v: deleted on one side and modified on the other", c.Row, c.Key)
+	}
+	return fmt.Sprintf("row %v key %v column %v: base %q ours %q theirs %q", c.Row, c.Key, c.ColumnName, c.Base, c.Ours, c.Theirs)
+}
+
+// 冲突的单元格内容,和git的冲突标记一样
+func conflictCell(ours, theirs string) string {
+	return "<<<<<<< ours\n" + ours + "\n=======\n" + theirs + "\n>>>>>>> theirs"
+}
+
+// 三方合并csv数据,key列和ReadCsvFromDataMap一样,base是共同的祖先版本
+//   - 按列名合并单元格,只有一边修改的单元格使用修改后的值,两边都修改成不同的值时,单元格写入冲突标记
+//   - 只有一边新增或者删除的行,使用修改的一边,一边删除了行,另一边修改了行时,保留修改的行,并在key列写入冲突标记
+//   - 只有一边删除的列,另一边没有修改这一列时删除,新增的列追加在后面
+//   - 表头和数据行之间的行(如类型和注释),按行号合并单元格
+//
+// 行和列的顺序以ours为准,theirs新增的行插入到theirs中的前一行之后
+// 没有列名的列不会保留
+// base为空时(如git的add/add冲突)当作没有数据行的表格
+func MergeTables(base, ours, theirs [][]string, option *CsvOption) ([][]string, []*MergeConflict, error) {
+	contexts := [3]*loadContext{newLoadContext("", option), newLoadContext("", option), newLoadContext("", option)}
+	return mergeTables(contexts, [3][][]string{base, ours, theirs})
+}
+
+// 三方合并csv文件,规则和MergeTables一样
+func MergeCsvFiles(baseFile, oursFile, theirsFile string, option *CsvOption) ([][]string, []*MergeConflict, error) {
+	var contexts [3]*loadContext
+	var tables [3][][]string
+	for i, file := range []string{baseFile, oursFile, theirsFile} {
+		rows, err := ReadCsvFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		// 错误信息里是各自的文件
+		contexts[i] = newLoadContext(file, option)
+		tables[i] = rows
+	}
+	return mergeTables(contexts, tables)
+}
+
+// 一个版本的csv数据
+type mergeSide struct {
+	// 列名,按顺序
+	columns []string
+	// 表头和数据行之间的行,按行号
+	headerRows []map[string]string
+	// 第一个key列的列名
+	keyColumn string
+	keys      []string
+	rows      map[string]map[string]string
+}
+
+// isBase为true时,空的数据当作没有数据行的表格
+func (lc *loadContext) parseMergeSide(rows [][]string, isBase bool) *mergeSide {
+	option := lc.option
+	if len(rows) == 0 && isBase {
+		return &mergeSide{
+			headerRows: make([]map[string]string, option.DataBeginRowIndex),
+			rows:       make(map[string]map[string]string),
+		}
+	}
+	if len(rows) == 0 {
+		lc.fail(ErrNoCsvHeader)
+		return nil
+	}
+	if len(rows) <= option.ColumnNameRowIndex {
+		lc.fail(ErrNoColumnNameHeader)
+		return nil
+	}
+	if option.DataBeginRowIndex <= option.ColumnNameRowIndex {
+		lc.fail(ErrDataBeginRowIndex)
+		return nil
+	}
+	side := &mergeSide{
+		rows: make(map[string]map[string]string),
+	}
+	header := rows[option.ColumnNameRowIndex]
+	columnIndexes := make([]int, 0, len(header))
+	for columnIndex, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(side.columns, name) {
+			continue
+		}
+		side.columns = append(side.columns, name)
+		columnIndexes = append(columnIndexes, columnIndex)
+	}
+	if len(side.columns) == 0 {
+		lc.fail(ErrNoColumn)
+		return nil
+	}
+	keyIndexes, ok := lc.keyColumnIndexes(nil, option.ColumnNameRowIndex, header, nil)
+	if !ok {
+		return nil
+	}
+	side.keyColumn = strings.TrimSpace(header[keyIndexes[0]])
+	toMap := func(row []string) map[string]string {
+		m := make(map[string]string, len(side.columns))
+		for i, columnIndex := range columnIndexes {
+			if columnIndex < len(row) {
+				m[side.columns[i]] = strings.TrimSpace(row[columnIndex])
+			}
+		}
+		return m
+	}
+	for rowIndex := 0; rowIndex < option.DataBeginRowIndex; rowIndex++ {
+		if rowIndex == option.ColumnNameRowIndex {
+			side.headerRows = append(side.headerRows, nil)
+			continue
+		}
+		var row []string
+		if rowIndex < len(rows) {
+			row = rows[rowIndex]
+		}
+		side.headerRows = append(side.headerRows, toMap(row))
+	}
+	keyRows := make(map[string]int)
+	for rowIndex := option.DataBeginRowIndex; rowIndex < len(rows); rowIndex++ {
+		row := rows[rowIndex]
+		if isBlankRow(row) {
+			continue
+		}
+		key := rowKeyString(row, keyIndexes)
+		if firstRowIndex, ok := keyRows[key]; ok {
+			// 重复的key无法合并
+			keyIndex := keyIndexes[0]
+			var cell string
+			if keyIndex < len(row) {
+				cell = row[keyIndex]
+			}
+			lc.addCellError(&DuplicateKeyError{Key: key, FirstRow: firstRowIndex + 1}, rowIndex, keyIndex, side.keyColumn, cell, "")
+			continue
+		}
+		keyRows[key] = rowIndex
+		side.keys = append(side.keys, key)
+		side.rows[key] = toMap(row)
+	}
+	return side
+}
+
+// 合并后的一行
+type mergedRow struct {
+	key   string
+	cells map[string]string
+}
+
+func mergeTables(contexts [3]*loadContext, tables [3][][]string) ([][]string, []*MergeConflict, error) {
+	var sides [3]*mergeSide
+	var errs LoadErrors
+	for i, rows := range tables {
+		sides[i] = contexts[i].parseMergeSide(rows, i == 0)
+		errs = append(errs, contexts[i].errs...)
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs.Err()
+	}
+	baseSide, oursSide, theirsSide := sides[0], sides[1], sides[2]
+	option := contexts[1].option
+	// 列: ours的列 + theirs新增的列
+	columns := slices.Clone(oursSide.columns)
+	for _, column := range theirsSide.columns {
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	var conflicts []*MergeConflict
+	// 冲突所在的行,用于最后计算行号
+	conflictRows := make(map[*MergeConflict]*mergedRow)
+	mergeRow := func(key string, baseRow, oursRow, theirsRow map[string]string) *mergedRow {
+		row := &mergedRow{key: key, cells: make(map[string]string, len(columns))}
+		for _, column := range columns {
+			b, o, t := baseRow[column], oursRow[column], theirsRow[column]
+			switch {
+			case o == t || t == b:
+				row.cells[column] = o
+			case o == b:
+				row.cells[column] = t
+			default:
+				row.cells[column] = conflictCell(o, t)
+				conflict := &MergeConflict{Key: key, ColumnName: column, Base: b, Ours: o, Theirs: t}
+				conflicts = append(conflicts, conflict)
+				conflictRows[conflict] = row
+			}
+		}
+		return row
+	}
+	// 一边删除了行,另一边修改了行,保留修改的行
+	deleteConflict := func(key string, modifiedRow map[string]string, oursDeleted bool) *mergedRow {
+		row := mergeRow(key, modifiedRow, modifiedRow, modifiedRow)
+		// 冲突标记写入第一个key列
+		keyColumn := oursSide.keyColumn
+		if oursDeleted {
+			row.cells[keyColumn] = conflictCell("", row.cells[keyColumn])
+		} else {
+			row.cells[keyColumn] = conflictCell(row.cells[keyColumn], "")
+		}
+		conflict := &MergeConflict{Key: key}
+		conflicts = append(conflicts, conflict)
+		conflictRows[conflict] = row
+		return row
+	}
+	var headerRows []*mergedRow
+	for rowIndex := range oursSide.headerRows {
+		if rowIndex == option.ColumnNameRowIndex {
+			headerRows = append(headerRows, nil)
+			continue
+		}
+		headerRows = append(headerRows, mergeRow("", baseSide.headerRows[rowIndex], oursSide.headerRows[rowIndex], theirsSide.headerRows[rowIndex]))
+	}
+	// 数据行,以ours的顺序为准
+	var dataRows []*mergedRow
+	for _, key := range oursSide.keys {
+		baseRow, inBase := baseSide.rows[key]
+		theirsRow, inTheirs := theirsSide.rows[key]
+		oursRow := oursSide.rows[key]
+		if inBase && !inTheirs {
+			if sameRow(baseRow, oursRow, oursSide.columns) {
+				// theirs删除了行
+				continue
+			}
+			dataRows = append(dataRows, deleteConflict(key, oursRow, false))
+			continue
+		}
+		dataRows = append(dataRows, mergeRow(key, baseRow, oursRow, theirsRow))
+	}
+	for i, key := range theirsSide.keys {
+		if _, ok := oursSide.rows[key]; ok {
+			continue
+		}
+		theirsRow := theirsSide.rows[key]
+		var row *mergedRow
+		if baseRow, inBase := baseSide.rows[key]; inBase {
+			if sameRow(baseRow, theirsRow, theirsSide.columns) {
+				// ours删除了行
+				continue
+			}
+			row = deleteConflict(key, theirsRow, true)
+		} else {
+			row = mergeRow(key, nil, nil, theirsRow)
+		}
+		// 插入到theirs中的前一行之后
+		insertIndex := 0
+		for j := i - 1; j >= 0; j-- {
+			index := slices.IndexFunc(dataRows, func(row *mergedRow) bool {
+				return row.key == theirsSide.keys[j]
+			})
+			if index >= 0 {
+				insertIndex = index + 1
+				break
+			}
+		}
+		dataRows = slices.Insert(dataRows, insertIndex, row)
+	}
+	mergedRows := append(headerRows, dataRows...)
+	// 只有一边删除的列,合并后这一列都为空时删除
+	columns = slices.DeleteFunc(columns, func(column string) bool {
+		if !slices.Contains(baseSide.columns, column) || (slices.Contains(oursSide.columns, column) && slices.Contains(theirsSide.columns, column)) {
+			return false
+		}
+		for _, row := range mergedRows {
+			if row != nil && row.cells[column] != "" {
+				return false
+			}
+		}
+		return true
+	})
+	result := make([][]string, len(mergedRows))
+	for rowIndex, row := range mergedRows {
+		cells := make([]string, len(columns))
+		for columnIndex, column := range columns {
+			if row == nil {
+				// 表头
+				cells[columnIndex] = column
+			} else {
+				cells[columnIndex] = row.cells[column]
+			}
+		}
+		result[rowIndex] = cells
+	}
+	for _, conflict := range conflicts {
+		conflict.Row = slices.Index(mergedRows, conflictRows[conflict]) + 1
+	}
+	return result, conflicts, nil
+}
+
+// columns是修改的一边的列,删除的列不算修改
+func sameRow(a, b map[string]string, columns []string) bool {
+	for _, column := range columns {
+		if a[column] != b[column] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package csv
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 把覆盖表(如地区,活动,热更新的配置)应用到已经加载的map上,key列和ReadCsvFromDataMap一样
+// 覆盖表只需要key列和修改的列,可以有多个覆盖表,按顺序依次调用
+//   - key已经存在时,只替换覆盖表中不为空的单元格对应的字段,单元格整体替换字段(如数组和子结构)
+//   - 单元格是CsvOption.OverlayEmptyValue(默认#empty)时,字段按空单元格处理,如清空或者使用默认值
+//   - key不存在时新增一行,和ReadCsvFromDataMap一样解析,覆盖表中没有的列按空单元格处理
+//   - CsvOption.OverlayDeleteColumnName列(默认#delete)的值为true时,删除key对应的行
+//   - 同一个key有多行时,按顺序依次应用
+//
+// 修改已有的行时,先复制一份再修改,不会修改m中原来的对象,如基础表和覆盖表可以共用同一批对象
+// 覆盖表不检查required的列
+func ApplyCsvOverlayFromDataMap[M ~map[K]V, K IntOrString, V any](rows [][]string, m M, option *CsvOption) error {
+	return applyCsvOverlayFromDataMap(newLoadContext("", option), rows, m)
+}
+
+// 读取覆盖表文件,应用到已经加载的map上,规则和ApplyCsvOverlayFromDataMap一样
+func ApplyCsvOverlayFileMap[M ~map[K]V, K IntOrString, V any](file string, m M, option *CsvOption) error {
+	rows, readErr := ReadCsvFile(file)
+	if readErr != nil {
+		return readErr
+	}
+	return applyCsvOverlayFromDataMap(newLoadContext(file, option), rows, m)
+}
+
+func applyCsvOverlayFromDataMap[M ~map[K]V, K IntOrString, V any](lc *loadContext, rows [][]string, m M) error {
+	option := lc.option
+	if len(rows) == 0 {
+		return lc.fail(ErrNoCsvHeader)
+	}
+	if len(rows) <= option.ColumnNameRowIndex {
+		return lc.fail(ErrNoColumnNameHeader)
+	}
+	columnNames := rows[option.ColumnNameRowIndex]
+	if len(columnNames) == 0 {
+		return lc.fail(ErrNoColumn)
+	}
+	if option.DataBeginRowIndex < 1 {
+		return lc.fail(ErrDataBeginRowIndex)
+	}
+	mType := reflect.TypeOf(m)
+	mVal := reflect.ValueOf(m)
+	keyType := mType.Key()    // key type of m, 如int
+	valueType := mType.Elem() // value type of m, 如*pb.ItemCfg or pb.ItemCfg
+	// 删除标记列不绑定字段
+	deleteColumnIndex := -1
+	fieldColumnNames := make([]string, len(columnNames))
+	for columnIndex, name := range columnNames {
+		if option.OverlayDeleteColumnName != "" && strings.TrimSpace(name) == option.OverlayDeleteColumnName {
+			deleteColumnIndex = columnIndex
+			continue
+		}
+		fieldColumnNames[columnIndex] = name
+	}
+	bindings, _ := lc.resolveColumns(rowElemType(valueType), option.ColumnNameRowIndex, fieldColumnNames)
+	keyBindings, ok := lc.bindKeyColumns(rowElemType(valueType), []reflect.Type{keyType}, option.ColumnNameRowIndex, columnNames, bindings)
+	if !ok {
+		return lc.errs.Err()
+	}
+	for rowIndex := option.DataBeginRowIndex; rowIndex < len(rows) && !lc.stopped; rowIndex++ {
+		row := lc.normalizeRow(rowIndex, rows[rowIndex], len(columnNames))
+		if row == nil {
+			continue
+		}
+		keyVals, ok := lc.convertKeys(rowIndex, row, keyBindings)
+		if !ok {
+			continue
+		}
+		keyVal := keyVals[0]
+		if deleteColumnIndex >= 0 {
+			deleteString := strings.TrimSpace(row[deleteColumnIndex])
+			if deleteString != "" {
+				deleted, err := strconv.ParseBool(deleteString)
+				if err != nil {
+					lc.addCellError(err, rowIndex, deleteColumnIndex, option.OverlayDeleteColumnName, row[deleteColumnIndex], "")
+					continue
+				}
+				if deleted {
+					mVal.SetMapIndex(keyVal, reflect.Value{})
+					continue
+				}
+			}
+		}
+		value := mVal.MapIndex(keyVal)
+		if !value.IsValid() || (valueType.Kind() == reflect.Ptr && value.IsNil()) {
+			// 新增的行
+			newRow := make([]string, len(row))
+			for columnIndex, cell := range row {
+				if !lc.isOverlayEmptyValue(cell) {
+					newRow[columnIndex] = cell
+				}
+			}
+			value = lc.convertRow(valueType, rowIndex, newRow, bindings)
+		} else {
+			// 复制一份,不修改原来的对象
+			copyValue := newRowValue(valueType)
+			reflect.Indirect(copyValue).Set(reflect.Indirect(value))
+			value = copyValue
+			lc.applyOverlayRow(value, rowIndex, row, bindings)
+		}
+		if lc.stopped {
+			break
+		}
+		mVal.SetMapIndex(keyVal, value)
+	}
+	return lc.errs.Err()
+}
+
+func (lc *loadContext) isOverlayEmptyValue(cell string) bool {
+	return lc.option.OverlayEmptyValue != "" && strings.TrimSpace(cell) == lc.option.OverlayEmptyValue
+}
+
+// 不为空的单元格整体替换已有的字段
+func (lc *loadContext) applyOverlayRow(object reflect.Value, rowIndex int, row []string, bindings []*columnBinding) {
+	objectElem := reflect.Indirect(object)
+	for _, binding := range bindings {
+		if lc.stopped {
+			return
+		}
+		fieldString := row[binding.columnIndex]
+		if strings.TrimSpace(fieldString) == "" {
+			continue
+		}
+		if lc.isOverlayEmptyValue(fieldString) {
+			fieldString = ""
+		}
+		lc.convertCell(object, objectElem, binding, rowIndex, fieldString, true)
+	}
+}
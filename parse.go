@@ -0,0 +1,230 @@
+package csv
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// 单元格的语法:
+//   - 数组的元素用SliceSeparator分隔,如1;2;3
+//   - 子结构和map用PairSeparator分隔K_V,用KvSeparator分隔K和V,如CfgId_1#Num_2
+//   - {}里的内容作为一个整体,可以包含外层的分隔符,{}可以嵌套任意层
+//     如Name_a#Items_{CfgId_1#Num_1;CfgId_2#Num_1};Name_b#Items_{CfgId_1#Num_2}
+//   - 数组的元素,map的value是基础类型,或者子结构的字段都是基础类型时,{}是普通字符,如smile :-{;ok
+//   - 分隔符可以按字段设置,如 `csv:",sep=|,kv=:,pair=,"`,见CsvOption.RegisterSeparatorsByColumnName
+//   - 转义字符(CsvOption.EscapeChar,默认\)后面的分隔符,{},转义字符不作为特殊字符,如Name_Fire\#Sword
+//
+// 解析时按字段的类型逐层分割,数组的元素,K和V,以{开头时去掉最外层的{}
+// 转义字符在转换成基础类型的值时才去掉,所以可以原样传递给内层
+
+// 单元格中的一段字符串,记录了在单元格中的位置,用于语法错误的位置
+type cellSegment struct {
+	cell string
+	// 在cell中的字节位置
+	begin, end int
+	// 转义字符,为空时不转义
+	escape string
+	// 为true时{}是普通字符,不作为一个整体,也不去掉
+	plain bool
+}
+
+func newCellSegment(cell, escape string) cellSegment {
+	return cellSegment{cell: cell, end: len(cell), escape: escape}
+}
+
+func (s cellSegment) sub(begin, end int) cellSegment {
+	return cellSegment{cell: s.cell, begin: begin, end: end, escape: s.escape, plain: s.plain}
+}
+
+// nested为false时{}是普通字符
+func (s cellSegment) withBraces(nested bool) cellSegment {
+	s.plain = !nested
+	return s
+}
+
+func (s cellSegment) String() string {
+	return s.cell[s.begin:s.end]
+}
+
+// pos是在cell中的字节位置,错误里是字符偏移
+func (s cellSegment) syntaxError(pos int, msg string) error {
+	return &SyntaxError{Offset: utf8.RuneCountInString(s.cell[:pos]), Msg: msg}
+}
+
+// i是转义字符时,返回转义的字符后面的位置,否则返回i
+func (s cellSegment) skipEscape(i int) int {
+	if s.escape == "" || !strings.HasPrefix(s.cell[i:s.end], s.escape) {
+		return i
+	}
+	i += len(s.escape)
+	_, size := utf8.DecodeRuneInString(s.cell[i:s.end])
+	return i + size
+}
+
+// {}外的分隔符的位置,最多n个,n<0时不限制数量
+// 同时检查{}是否匹配,plain为true时不检查
+func (s cellSegment) separatorIndexes(separator string, n int) ([]int, error) {
+	var indexes []int
+	// 还没有闭合的{的位置
+	var opens []int
+	for i := s.begin; i < s.end; {
+		if next := s.skipEscape(i); next != i {
+			i = next
+			continue
+		}
+		switch {
+		case !s.plain && s.cell[i] == '{':
+			opens = append(opens, i)
+		case !s.plain && s.cell[i] == '}':
+			if len(opens) == 0 {
+				return nil, s.syntaxError(i, "unexpected }")
+			}
+			opens = opens[:len(opens)-1]
+		case len(opens) == 0 && separator != "" && (n < 0 || len(indexes) < n) && strings.HasPrefix(s.cell[i:s.end], separator):
+			indexes = append(indexes, i)
+			i += len(separator)
+			continue
+		}
+		i++
+	}
+	if len(opens) > 0 {
+		return nil, s.syntaxError(opens[len(opens)-1], "unclosed {")
+	}
+	return indexes, nil
+}
+
+// 按{}外的分隔符分割
+func (s cellSegment) split(separator string) ([]cellSegment, error) {
+	indexes, err := s.separatorIndexes(separator, -1)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]cellSegment, 0, len(indexes)+1)
+	begin := s.begin
+	for _, index := range indexes {
+		segments = append(segments, s.sub(begin, index))
+		begin = index + len(separator)
+	}
+	return append(segments, s.sub(begin, s.end)), nil
+}
+
+// 在第一个{}外的分隔符处分成两段,没有分隔符时found为false
+func (s cellSegment) cut(separator string) (before, after cellSegment, found bool, err error) {
+	indexes, err := s.separatorIndexes(separator, 1)
+	if err != nil || len(indexes) == 0 {
+		return s, cellSegment{}, false, err
+	}
+	return s.sub(s.begin, indexes[0]), s.sub(indexes[0]+len(separator), s.end), true, nil
+}
+
+// 以{开头时去掉最外层的{},}后面不能再有其他内容,plain为true时不去掉
+func (s cellSegment) unwrap() (cellSegment, error) {
+	if s.plain || s.begin == s.end || s.cell[s.begin] != '{' {
+		return s, nil
+	}
+	depth := 0
+	for i := s.begin; i < s.end; i++ {
+		if next := s.skipEscape(i); next != i {
+			i = next - 1
+			continue
+		}
+		switch s.cell[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				if i != s.end-1 {
+					return s, s.syntaxError(i+1, "unexpected text after }")
+				}
+				return s.sub(s.begin+1, i), nil
+			}
+		}
+	}
+	return s, s.syntaxError(s.begin, "unclosed {")
+}
+
+// 去掉特殊字符前面的转义字符,其他字符前面的转义字符保持原样,如C:\dir
+func (s cellSegment) unescape(separators ...string) string {
+	text := s.String()
+	if s.escape == "" || !strings.Contains(text, s.escape) {
+		return text
+	}
+	var sb strings.Builder
+	for i := 0; i < len(text); {
+		if strings.HasPrefix(text[i:], s.escape) {
+			next := i + len(s.escape)
+			r, size := utf8.DecodeRuneInString(text[next:])
+			if size > 0 && isSpecialRune(r, s.escape, separators) {
+				sb.WriteString(text[next : next+size])
+				i = next + size
+				continue
+			}
+		}
+		sb.WriteByte(text[i])
+		i++
+	}
+	return sb.String()
+}
+
+// 转义值里的特殊字符,separators是当前位置的分隔符
+// 没有转义字符时,值里不能有特殊字符,否则返回ErrSeparatorInValue
+func escapeValue(s, escape string, separators []string) (string, error) {
+	if escape == "" {
+		return s, checkSeparator(s, appendSeparators(separators, "{", "}"))
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if isSpecialRune(r, escape, separators) {
+			sb.WriteString(escape)
+		}
+		sb.WriteString(s[i : i+size])
+		i += size
+	}
+	return sb.String(), nil
+}
+
+// 分隔符里的字符,{},转义字符是特殊字符
+func isSpecialRune(r rune, escape string, separators []string) bool {
+	if r == '{' || r == '}' || strings.ContainsRune(escape, r) {
+		return true
+	}
+	for _, separator := range separators {
+		if strings.ContainsRune(separator, r) {
+			return true
+		}
+	}
+	return false
+}
+
+type segmentPair struct {
+	key   cellSegment
+	value cellSegment
+}
+
+// 如K1_V1#K2_{V2}转换成[{K1,V1},{K2,V2}],没有KvSeparator的部分会被忽略
+func (s cellSegment) pairs(pairSeparator, kvSeparator string) ([]segmentPair, error) {
+	segments, err := s.split(pairSeparator)
+	if err != nil {
+		return nil, err
+	}
+	var pairs []segmentPair
+	for _, segment := range segments {
+		key, value, found, err := segment.cut(kvSeparator)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		if key, err = key.unwrap(); err != nil {
+			return nil, err
+		}
+		if value, err = value.unwrap(); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, segmentPair{key: key, value: value})
+	}
+	return pairs, nil
+}
@@ -0,0 +1,121 @@
+package csv
+
+import (
+	"go/token"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// 模板中一列的信息
+type TemplateColumn struct {
+	// 列名,和写入csv时的规则一样
+	ColumnName string
+	// 字段名
+	FieldName string
+	// 字段的类型,如int32,[]*pb.ItemNum
+	TypeName string
+	// tag里的注释,如 `csv:",comment=物品名"`
+	Comment string
+	// 读取时也能识别的其他列名(字段名,protobuf和json的字段别名),和getAliasNameMap的规则一样
+	AliasNames []string
+}
+
+// 根据字段名,类型名和struct tag生成模板的列信息
+// 忽略的列,csv:"-"的字段和未导出的字段返回nil
+func NewTemplateColumn(fieldName, typeName string, tag reflect.StructTag, option *CsvOption) *TemplateColumn {
+	if option == nil {
+		option = &DefaultOption
+	}
+	if !token.IsExported(fieldName) {
+		return nil
+	}
+	csvTag := parseCsvTag(tag)
+	if csvTag.Skip || csvTag.Ignore {
+		return nil
+	}
+	field := reflect.StructField{Name: fieldName, Tag: tag}
+	columnName := columnNameOfField(field, option)
+	if _, ok := option.ignoreColumns[columnName]; ok {
+		return nil
+	}
+	if _, ok := option.ignoreColumns[fieldName]; ok {
+		return nil
+	}
+	column := &TemplateColumn{
+		ColumnName: columnName,
+		FieldName:  fieldName,
+		TypeName:   typeName,
+		Comment:    csvTag.Comment,
+	}
+	if csvTag.Name != "" {
+		// 有csv tag列名时只能用这个列名
+		return column
+	}
+	aliasNames := []string{fieldName}
+	if !option.DisableProtobufAliasName {
+		aliasNames = append(aliasNames, getProtobufNameFromStructTag(tag))
+	}
+	if !option.DisableJsonAliasName {
+		aliasNames = append(aliasNames, getJsonNameFromStructTag(tag))
+	}
+	for _, name := range aliasNames {
+		if name == "" || name == "-" || name == columnName {
+			continue
+		}
+		if !slices.Contains(column.AliasNames, name) {
+			column.AliasNames = append(column.AliasNames, name)
+		}
+	}
+	return column
+}
+
+// 结构体生成空的csv模板
+// 表头在ColumnNameRowIndex,表头和DataBeginRowIndex之间的行依次填写: 字段类型,注释,其他列名
+func GenerateCsvTemplate(typ reflect.Type, option *CsvOption) ([][]string, error) {
+	lc := newLoadContext("", option)
+	elemType := rowElemType(typ)
+	if elemType.Kind() != reflect.Struct {
+		return nil, lc.fail(ErrUnsupportedKind)
+	}
+	var columns []*TemplateColumn
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if column := NewTemplateColumn(field.Name, field.Type.String(), field.Tag, lc.option); column != nil {
+			columns = append(columns, column)
+		}
+	}
+	return BuildCsvTemplate(columns, lc.option)
+}
+
+// 根据列信息生成空的csv模板,规则和GenerateCsvTemplate一样
+func BuildCsvTemplate(columns []*TemplateColumn, option *CsvOption) ([][]string, error) {
+	lc := newLoadContext("", option)
+	option = lc.option
+	if option.DataBeginRowIndex < 1 {
+		return nil, lc.fail(ErrDataBeginRowIndex)
+	}
+	if len(columns) == 0 {
+		return nil, lc.fail(ErrNoColumn)
+	}
+	rowCount := option.DataBeginRowIndex
+	if rowCount <= option.ColumnNameRowIndex {
+		rowCount = option.ColumnNameRowIndex + 1
+	}
+	rows := make([][]string, rowCount)
+	for i := range rows {
+		rows[i] = make([]string, len(columns))
+	}
+	for columnIndex, column := range columns {
+		metas := []string{column.TypeName, column.Comment, strings.Join(column.AliasNames, " ")}
+		rows[option.ColumnNameRowIndex][columnIndex] = column.ColumnName
+		for i, meta := range metas {
+			rowIndex := option.ColumnNameRowIndex + 1 + i
+			if rowIndex >= rowCount {
+				break
+			}
+			rows[rowIndex][columnIndex] = meta
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,394 @@
+package csv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// 结构体字段对应的列名
+// 优先级: csv tag里的列名 > 字段名,和读取时的优先级一致,protobuf和json的字段别名只用于读取,如已有的表头cfg_id
+func columnNameOfField(field reflect.StructField, option *CsvOption) string {
+	if name := parseCsvTag(field.Tag).Name; name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// 结构体的导出字段对应的列,按字段的声明顺序,忽略的列和csv:"-"的字段不写入
+func getWriteColumns(elemType reflect.Type, option *CsvOption) []*columnBinding {
+	var columns []*columnBinding
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := parseCsvTag(field.Tag)
+		if tag.Skip || tag.Ignore {
+			continue
+		}
+		columnName := columnNameOfField(field, option)
+		if _, ok := option.ignoreColumns[columnName]; ok {
+			continue
+		}
+		if _, ok := option.ignoreColumns[field.Name]; ok {
+			continue
+		}
+		columns = append(columns, &columnBinding{
+			columnIndex: len(columns),
+			columnName:  columnName,
+			fieldName:   field.Name,
+			fieldIndex:  field.Index,
+			tag:         tag,
+		})
+	}
+	return columns
+}
+
+// map转换成csv数据
+// V支持proto.Message和普通struct结构
+// 第一列是key,数据行按key排序,配置了key列(CsvOption.KeyColumnNames或者csv:",key")时,key列写入字段的值
+// 没有配置key列时,第一列的字段的值和map的key不一致时返回错误,如第一列不是key对应的字段
+func WriteCsvToDataMap[M ~map[K]V, K IntOrString, V any](m M, option *CsvOption) ([][]string, error) {
+	return writeCsvToDataMap(newLoadContext("", option), m)
+}
+
+func writeCsvToDataMap[M ~map[K]V, K IntOrString, V any](lc *loadContext, m M) ([][]string, error) {
+	valueType := reflect.TypeOf(m).Elem() // value type of m, 如*pb.ItemCfg or pb.ItemCfg
+	if hasKeyColumns(rowElemType(valueType), lc.option) {
+		// 配置了key列时,key列写入字段的值
+		return lc.writeTable(rowElemType(valueType), flattenMap(reflect.ValueOf(m)), nil)
+	}
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	values := make([]reflect.Value, len(keys))
+	rowKeys := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = reflect.ValueOf(m[k])
+		rowKeys[i], _ = formatBasicValue(reflect.ValueOf(k))
+	}
+	return lc.writeTable(rowElemType(valueType), values, rowKeys)
+}
+
+// 组合key的map转换成csv数据,和ReadCsvFromDataKeyMap对应
+// V可以是嵌套的map,如map[int32]map[int32]*pb.SkillLevelCfg,key列写入字段的值,数据行按key排序
+func WriteCsvToDataKeyMap[M ~map[K]V, K comparable, V any](m M, option *CsvOption) ([][]string, error) {
+	return writeCsvToDataKeyMap(newLoadContext("", option), m)
+}
+
+func writeCsvToDataKeyMap[M ~map[K]V, K comparable, V any](lc *loadContext, m M) ([][]string, error) {
+	mVal := reflect.ValueOf(m)
+	_, valueType := mapKeyTypes(mVal.Type())
+	return lc.writeTable(rowElemType(valueType), flattenMap(mVal), nil)
+}
+
+// 组合key的map写入csv文件
+func WriteCsvFileKeyMap[M ~map[K]V, K comparable, V any](file string, m M, option *CsvOption) error {
+	rows, err := writeCsvToDataKeyMap(newLoadContext(file, option), m)
+	if err != nil {
+		return err
+	}
+	return WriteCsvFile(file, rows)
+}
+
+// slice转换成csv数据
+// V支持proto.Message和普通struct结构
+func WriteCsvToDataSlice[Slice ~[]V, V any](s Slice, option *CsvOption) ([][]string, error) {
+	return writeCsvToDataSlice(newLoadContext("", option), s)
+}
+
+func writeCsvToDataSlice[Slice ~[]V, V any](lc *loadContext, s Slice) ([][]string, error) {
+	values := make([]reflect.Value, len(s))
+	for i := range s {
+		values[i] = reflect.ValueOf(s[i])
+	}
+	valueType := reflect.TypeOf(s).Elem() // value type of s, 如*pb.ItemCfg or pb.ItemCfg
+	return lc.writeTable(rowElemType(valueType), values, nil)
+}
+
+// map写入csv文件
+// V支持proto.Message和普通struct结构
+// 第一列是key,数据行按key排序
+func WriteCsvFileMap[M ~map[K]V, K IntOrString, V any](file string, m M, option *CsvOption) error {
+	rows, err := writeCsvToDataMap(newLoadContext(file, option), m)
+	if err != nil {
+		return err
+	}
+	return WriteCsvFile(file, rows)
+}
+
+// slice写入csv文件
+// V支持proto.Message和普通struct结构
+func WriteCsvFileSlice[Slice ~[]V, V any](file string, s Slice, option *CsvOption) error {
+	rows, err := writeCsvToDataSlice(newLoadContext(file, option), s)
+	if err != nil {
+		return err
+	}
+	return WriteCsvFile(file, rows)
+}
+
+func WriteCsvFile(file string, rows [][]string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err = WriteCsv(f, rows); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func WriteCsv(w io.Writer, rows [][]string) error {
+	return csv.NewWriter(w).WriteAll(rows)
+}
+
+// 生成表头和数据行,表头在ColumnNameRowIndex,数据从DataBeginRowIndex开始,中间的行为空
+// rowKeys不为nil时,第一列使用rowKeys,如map的key,第一列字段的值和key不一致时返回错误
+// nil指针的数据不写入,读取时也会跳过空行
+func (lc *loadContext) writeTable(elemType reflect.Type, values []reflect.Value, rowKeys []string) ([][]string, error) {
+	option := lc.option
+	if option.DataBeginRowIndex < 1 {
+		return nil, lc.fail(ErrDataBeginRowIndex)
+	}
+	columns := getWriteColumns(elemType, option)
+	if len(columns) == 0 {
+		return nil, lc.fail(ErrNoColumn)
+	}
+	headerRowCount := option.DataBeginRowIndex
+	if headerRowCount <= option.ColumnNameRowIndex {
+		headerRowCount = option.ColumnNameRowIndex + 1
+	}
+	rows := make([][]string, headerRowCount, headerRowCount+len(values))
+	for i := range rows {
+		rows[i] = make([]string, len(columns))
+	}
+	for columnIndex, column := range columns {
+		rows[option.ColumnNameRowIndex][columnIndex] = column.columnName
+		lc.checkFormatter(option.ColumnNameRowIndex, column, elemType.FieldByIndex(column.fieldIndex).Type)
+	}
+	for i, value := range values {
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		rowIndex := len(rows)
+		row := make([]string, len(columns))
+		for columnIndex, column := range columns {
+			if columnIndex == 0 && rowKeys != nil {
+				// 第一列是key,字段的值和key不一致时,读取回来的数据会不一样
+				row[columnIndex] = rowKeys[i]
+				if cell, err := lc.formatCell(value, column, true); err != nil || cell != rowKeys[i] {
+					if err == nil {
+						err = fmt.Errorf("%w: key %v, column %v is %q", ErrKeyColumn, rowKeys[i], column.columnName, cell)
+					}
+					lc.addCellError(err, rowIndex, columnIndex, column.columnName, rowKeys[i], column.fieldName)
+				}
+				continue
+			}
+			cell, err := lc.formatCell(value, column, false)
+			if err != nil {
+				lc.addCellError(err, rowIndex, columnIndex, column.columnName, "", column.fieldName)
+				continue
+			}
+			row[columnIndex] = cell
+		}
+		rows = append(rows, row)
+		if lc.stopped {
+			break
+		}
+	}
+	return removeOmitEmptyColumns(rows, headerRowCount, columns), lc.errs.Err()
+}
+
+// 删除omitempty并且数据行都为空的列
+func removeOmitEmptyColumns(rows [][]string, dataBeginRowIndex int, columns []*columnBinding) [][]string {
+	var removeIndexes []int
+	for columnIndex, column := range columns {
+		if !column.tag.OmitEmpty {
+			continue
+		}
+		empty := true
+		for _, row := range rows[dataBeginRowIndex:] {
+			if row[columnIndex] != "" {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			removeIndexes = append(removeIndexes, columnIndex)
+		}
+	}
+	if len(removeIndexes) == 0 {
+		return rows
+	}
+	for i, row := range rows {
+		newRow := make([]string, 0, len(row)-len(removeIndexes))
+		for columnIndex, cell := range row {
+			if !slices.Contains(removeIndexes, columnIndex) {
+				newRow = append(newRow, cell)
+			}
+		}
+		rows[i] = newRow
+	}
+	return rows
+}
+
+// 零值写入空单元格,但是有默认值或者nonempty的字段需要写入零值,否则读取时会被替换成默认值或者报错
+// keepZero为true时,零值总是写入
+// 格式化过程中的panic(如自定义格式化接口的bug)会被转换成错误
+func (lc *loadContext) formatCell(object reflect.Value, column *columnBinding, keepZero bool) (cell string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	fieldVal := object.FieldByIndex(column.fieldIndex)
+	if !keepZero {
+		keepZero = column.tag.NonEmpty
+	}
+	if !keepZero {
+		_, keepZero = lc.option.getDefault(column, fieldVal.Type())
+	}
+	return formatFieldValue(fieldVal, column.columnName, lc.columnOption(column), keepZero)
+}
+
+// 有转换接口但是没有格式化接口的列,写入的字符串可能无法再读取回来
+// 严格模式下返回错误,否则输出警告
+func (lc *loadContext) checkFormatter(rowIndex int, column *columnBinding, fieldType reflect.Type) {
+	option := lc.option
+	if option.GetFormatterByColumnName(column.columnName) != nil {
+		return
+	}
+	var err error
+	if option.getConverterByColumnName(column.columnName, nil) != nil {
+		err = fmt.Errorf("%w: column %v", ErrNoFormatter, column.columnName)
+	} else {
+		// 字段类型,数组元素类型和map的value类型都可能注册了转换接口
+		fieldType = rowElemType(fieldType)
+		types := []reflect.Type{fieldType}
+		if fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Map {
+			types = append(types, rowElemType(fieldType.Elem()))
+		}
+		for _, typ := range types {
+			if converter, _ := option.getConverterByTypePtrOrStruct(typ, nil); converter == nil {
+				continue
+			}
+			if formatter, _ := option.getFormatterByTypePtrOrElem(typ); formatter == nil {
+				err = fmt.Errorf("%w: type %v", ErrNoFormatter, typ)
+				break
+			}
+		}
+	}
+	if err == nil {
+		return
+	}
+	if option.Strict {
+		lc.addCellError(err, rowIndex, column.columnIndex, column.columnName, column.columnName, column.fieldName)
+		return
+	}
+	location := cellLocation(rowIndex, column.columnIndex, column.columnName, column.columnName)
+	location.FieldPath = column.fieldName
+	lc.warn(location, err)
+}
+
+// 对象转换成key-value格式的csv数据,每个导出字段一行,按字段的声明顺序,Key列使用字段的列名(别名规则和写入表头时一样)
+// rows是已有的csv数据,可以为nil,已有的行保持原来的顺序和注释,只替换Value列,新的字段追加在后面
+// 注释来自已有的数据,或者tag里的comment,如 `csv:",comment=画质设置"`
+// V支持proto.Message和普通struct结构
+func WriteCsvFromObject[V any](rows [][]string, v V, option *CsvOption) ([][]string, error) {
+	return writeCsvFromObject(newLoadContext("", option), rows, v)
+}
+
+// 对象写入key-value格式的csv文件,文件已经存在时,保留原来的行顺序和注释
+// V支持proto.Message和普通struct结构
+func WriteCsvFileObject[V any](file string, v V, option *CsvOption) error {
+	rows, err := ReadCsvFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	rows, err = writeCsvFromObject(newLoadContext(file, option), rows, v)
+	if err != nil {
+		return err
+	}
+	return WriteCsvFile(file, rows)
+}
+
+func writeCsvFromObject[V any](lc *loadContext, rows [][]string, v V) ([][]string, error) {
+	option := lc.option
+	if option.ObjectDataBeginRowIndex < 1 {
+		return nil, lc.fail(ErrObjectDataBeginRowIndex)
+	}
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return nil, lc.fail(ErrObjectNotPtr)
+	}
+	valElem := val.Elem() // *pb.ItemCfg -> pb.ItemCfg
+	// 复制一份,不修改传入的数据
+	newRows := make([][]string, len(rows))
+	for i, row := range rows {
+		newRows[i] = slices.Clone(row)
+	}
+	if len(newRows) == 0 {
+		newRows = append(newRows, []string{"Key", "Value", "comment"})
+	}
+	if len(newRows[0]) < 2 {
+		return nil, lc.fail(ErrObjectColumnCount)
+	}
+	columnCount := len(newRows[0])
+	for len(newRows) < option.ObjectDataBeginRowIndex {
+		newRows = append(newRows, make([]string, columnCount))
+	}
+	// 已有的行对应的字段
+	resolver := newFieldResolver(valElem.Type(), option)
+	fieldRows := make(map[string]int)
+	for rowIndex := option.ObjectDataBeginRowIndex; rowIndex < len(newRows); rowIndex++ {
+		if len(newRows[rowIndex]) == 0 {
+			continue
+		}
+		if field, ok := resolver.resolve(strings.TrimSpace(newRows[rowIndex][0])); ok {
+			if _, exists := fieldRows[field.Name]; !exists {
+				fieldRows[field.Name] = rowIndex
+			}
+		}
+	}
+	for _, column := range getWriteColumns(valElem.Type(), option) {
+		// key-value的固定格式,Value列是字段的值
+		column.columnIndex = 1
+		rowIndex, ok := fieldRows[column.fieldName]
+		cell, err := lc.formatCell(valElem, column, false)
+		if !ok {
+			if err == nil && cell == "" && column.tag.OmitEmpty {
+				// 值为空时不写入新的行
+				continue
+			}
+			rowIndex = len(newRows)
+			newRows = append(newRows, []string{column.columnName})
+		}
+		row := padRow(newRows[rowIndex], columnCount)
+		// 第3列是注释列
+		if len(row) > 2 && row[2] == "" {
+			row[2] = column.tag.Comment
+		}
+		if err != nil {
+			lc.addCellError(err, rowIndex, column.columnIndex, column.columnName, "", column.fieldName)
+		} else {
+			row[1] = cell
+		}
+		newRows[rowIndex] = row
+		if lc.stopped {
+			break
+		}
+	}
+	return newRows, lc.errs.Err()
+}